@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"aaai/prompt"
+	"aaai/provider"
+	"context"
+	"fmt"
+)
+
+// DefaultMaxSteps bounds the number of requests in one Run.
+const DefaultMaxSteps = 12
+
+// Instructions is appended to the system prompt in agent mode, where the
+// files are not part of the prompt.
+const Instructions = `The repository files are not included in this message.
+Use the list_dir, read_file, grep and go_doc tools to find and read the
+code you need, reading only what is relevant. When you have seen enough,
+stop calling tools and answer with the diffs. Only edit files you have read.`
+
+// Agent lets a model explore a repository with tools before answering.
+type Agent struct {
+	Client   provider.Provider
+	Toolbox  *Toolbox
+	MaxSteps int
+}
+
+func New(client provider.Provider, dir string) (*Agent, error) {
+	if !client.Capabilities().Tools {
+		return nil, fmt.Errorf("agent mode needs tool use, which %s does not support", client.Name())
+	}
+	return &Agent{
+		Client:   client,
+		Toolbox:  NewToolbox(dir),
+		MaxSteps: DefaultMaxSteps,
+	}, nil
+}
+
+// Run sends conv with the toolbox attached and executes the model's tool
+// calls until it answers without calling any. On the last step the model
+// is told to answer; a tool call after that is an error. The returned
+// response is the final answer with the usage of every step.
+func (a *Agent) Run(ctx context.Context, conv *prompt.Conversation, h prompt.Handler) (*provider.Response, error) {
+	conv = conv.Clone()
+	conv.Tools = a.Toolbox.Tools()
+
+	var usage prompt.Usage
+	for step := 1; ; step++ {
+		resp, err := a.Client.Stream(ctx, conv, h)
+		if resp != nil {
+			usage.Add(resp.Usage)
+			resp.Usage = usage
+		}
+		if err != nil {
+			return resp, err
+		}
+		if resp.StopReason != provider.StopToolUse {
+			return resp, nil
+		}
+		if step >= a.MaxSteps {
+			return resp, fmt.Errorf("model kept calling tools after %d steps", a.MaxSteps)
+		}
+
+		results := make([]prompt.ToolResult, len(resp.ToolCalls))
+		for i, call := range resp.ToolCalls {
+			results[i] = a.Toolbox.Call(ctx, call)
+		}
+		conv.AddToolCalls(resp.Text, resp.ToolCalls, resp.Thinking)
+		conv.AddToolResults(results)
+		if step == a.MaxSteps-1 {
+			last := &conv.Messages[len(conv.Messages)-1]
+			last.Content = "That was the last tool call allowed. Answer with the edits now."
+		}
+	}
+}
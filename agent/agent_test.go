@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"aaai/mock"
+	"aaai/prompt"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const hello = "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "hello.go"), []byte(hello), 0644)
+
+	client, err := mock.New("../mock/testdata/anthropic_tool_use.sse", "../mock/testdata/anthropic_edit.sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(client, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conv := prompt.NewConversation().With("print hello, world")
+	resp, err := a.Run(context.Background(), conv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resp.Text, "+++ hello.go") || !resp.Finished() {
+		t.Errorf("got %+v", resp)
+	}
+	if resp.Usage.InputTokens != 903+412 || resp.Usage.OutputTokens != 71+58 {
+		t.Errorf("usage not summed over steps: %+v", resp.Usage)
+	}
+	if len(conv.Messages) != 1 || conv.Tools != nil {
+		t.Errorf("caller's conversation modified: %+v", conv)
+	}
+
+	var second struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content []struct {
+				Type      string `json:"type"`
+				ToolUseID string `json:"tool_use_id"`
+				Content   string `json:"content"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	json.Unmarshal(client.Replayer.Requests[1], &second)
+	last := second.Messages[len(second.Messages)-1]
+	if last.Role != "user" || last.Content[0].Type != "tool_result" || last.Content[0].Content != hello {
+		t.Errorf("tool result not sent back: %+v", last)
+	}
+}
+
+func TestRunStepLimit(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "hello.go"), []byte(hello), 0644)
+
+	transcript := "../mock/testdata/anthropic_tool_use.sse"
+	client, err := mock.New(transcript, transcript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := New(client, dir)
+	a.MaxSteps = 2
+
+	if _, err := a.Run(context.Background(), prompt.NewConversation().With("hi"), nil); err == nil {
+		t.Fatal("expected error when the model keeps calling tools")
+	}
+	if !strings.Contains(string(client.Replayer.Requests[1]), "last tool call allowed") {
+		t.Error("model not told to answer on the last step")
+	}
+}
+
+func TestToolbox(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "pkg"), 0755)
+	os.WriteFile(filepath.Join(dir, "hello.go"), []byte(hello), 0644)
+	os.WriteFile(filepath.Join(dir, "pkg", "util.go"), []byte("package pkg\n\nfunc Hello() string { return \"hello\" }\n"), 0644)
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("func Hello() secret\n"), 0644)
+	os.Symlink(outside, filepath.Join(dir, "home"))
+	os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "pkg", "secret.txt"))
+	tb := NewToolbox(dir)
+
+	tests := []struct {
+		name    string
+		tool    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"List root", "list_dir", `{"path":"."}`, "hello.go\nhome\npkg/\n", false},
+		{"Read range", "read_file", `{"path":"hello.go","start_line":5,"end_line":6}`, "func main() {\n\tfmt.Println(\"hello\")\n", false},
+		{"Grep", "grep", `{"pattern":"Hello\\(\\)"}`, "pkg/util.go:3: func Hello() string { return \"hello\" }", false},
+		{"Grep no match", "grep", `{"pattern":"nothing here"}`, "no matches", false},
+		{"Escape root", "read_file", `{"path":"../secret"}`, "", true},
+		{"Absolute path", "list_dir", `{"path":"/etc"}`, "", true},
+		{"Linked directory", "list_dir", `{"path":"home"}`, "", true},
+		{"Linked file", "read_file", `{"path":"home/secret.txt"}`, "", true},
+		{"Grep linked file", "grep", `{"pattern":"secret","path":"pkg"}`, "no matches", false},
+		{"Missing file", "read_file", `{"path":"nope.go"}`, "", true},
+		{"Unknown tool", "rm", `{}`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tb.Call(context.Background(), prompt.ToolCall{ID: "1", Name: tt.tool, Input: json.RawMessage(tt.input)})
+			if r.ToolCallID != "1" {
+				t.Errorf("result not tied to call: %+v", r)
+			}
+			if r.IsError != tt.wantErr {
+				t.Fatalf("got error %v (%s), want %v", r.IsError, r.Content, tt.wantErr)
+			}
+			if !tt.wantErr && r.Content != tt.want {
+				t.Errorf("got %q, want %q", r.Content, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"aaai/prompt"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxReadBytes   = 100 * 1024
+	maxListEntries = 500
+	maxGrepMatches = 200
+	goDocTimeout   = 20 * time.Second
+)
+
+// Toolbox implements read-only exploration tools over Dir.
+type Toolbox struct {
+	Dir string
+
+	// Read records the files read_file has shown the model, by slash
+	// separated path relative to Dir.
+	Read map[string]bool
+}
+
+func NewToolbox(dir string) *Toolbox {
+	return &Toolbox{Dir: dir, Read: map[string]bool{}}
+}
+
+// Tools returns the declarations sent to the model.
+func (t *Toolbox) Tools() []prompt.Tool {
+	return []prompt.Tool{
+		{
+			Name:        "list_dir",
+			Description: "List the files and directories in a directory of the repository. Directories end in /.",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"path":{"type":"string","description":"directory relative to the repository root, . for the root"}},"required":["path"]}`),
+		},
+		{
+			Name:        "read_file",
+			Description: "Read a file of the repository, optionally only a range of lines.",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"path":{"type":"string","description":"file relative to the repository root"},"start_line":{"type":"integer","description":"first line to return, 1-based"},"end_line":{"type":"integer","description":"last line to return"}},"required":["path"]}`),
+		},
+		{
+			Name:        "grep",
+			Description: "Search the repository for a regular expression (Go syntax). Returns path:line: text for each match.",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"pattern":{"type":"string"},"path":{"type":"string","description":"directory or file to search, defaults to the whole repository"}},"required":["pattern"]}`),
+		},
+		{
+			Name:        "go_doc",
+			Description: "Show Go documentation using go doc, for example a package path, pkg.Symbol or pkg.Type.Method.",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"query":{"type":"string"}},"required":["query"]}`),
+		},
+	}
+}
+
+// Call runs a tool call and returns its result. Failures are reported to
+// the model as error results rather than aborting the loop.
+func (t *Toolbox) Call(ctx context.Context, call prompt.ToolCall) prompt.ToolResult {
+	var in struct {
+		Path      string `json:"path"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+		Pattern   string `json:"pattern"`
+		Query     string `json:"query"`
+	}
+	result := prompt.ToolResult{ToolCallID: call.ID}
+	if err := json.Unmarshal(call.Input, &in); err != nil {
+		result.Content = fmt.Sprintf("invalid input: %v", err)
+		result.IsError = true
+		return result
+	}
+
+	var out string
+	var err error
+	switch call.Name {
+	case "list_dir":
+		out, err = t.listDir(in.Path)
+	case "read_file":
+		out, err = t.readFile(in.Path, in.StartLine, in.EndLine)
+	case "grep":
+		out, err = t.grep(in.Pattern, in.Path)
+	case "go_doc":
+		out, err = t.goDoc(ctx, in.Query)
+	default:
+		err = fmt.Errorf("unknown tool %q", call.Name)
+	}
+	if err != nil {
+		result.Content = err.Error()
+		result.IsError = true
+		return result
+	}
+	result.Content = out
+	return result
+}
+
+// resolve turns a path from the model into one inside Dir.
+func (t *Toolbox) resolve(path string) (string, error) {
+	if path == "" {
+		path = "."
+	}
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("%s: paths must be relative to the repository root", path)
+	}
+	clean := filepath.Clean(path)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: path is outside the repository", path)
+	}
+	full := filepath.Join(t.Dir, clean)
+	if err := t.within(path, full); err != nil {
+		return "", err
+	}
+	return full, nil
+}
+
+// within returns an error unless full, once symlinks are followed, is
+// inside Dir, so that a link in the repository can't expose other files.
+func (t *Toolbox) within(path, full string) error {
+	target, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(t.Dir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s: path is outside the repository", path)
+	}
+	return nil
+}
+
+func (t *Toolbox) listDir(path string) (string, error) {
+	full, err := t.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(full)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, e := range entries {
+		if i == maxListEntries {
+			fmt.Fprintf(&b, "... %d more entries\n", len(entries)-i)
+			break
+		}
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		b.WriteString(name + "\n")
+	}
+	return b.String(), nil
+}
+
+func (t *Toolbox) readFile(path string, start, end int) (string, error) {
+	full, err := t.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return "", err
+	}
+	if t.Read == nil {
+		t.Read = map[string]bool{}
+	}
+	t.Read[filepath.ToSlash(filepath.Clean(path))] = true
+
+	if start > 0 || end > 0 {
+		lines := strings.SplitAfter(string(data), "\n")
+		if start < 1 {
+			start = 1
+		}
+		if end <= 0 || end > len(lines) {
+			end = len(lines)
+		}
+		if start > end {
+			return "", fmt.Errorf("%s has %d lines", path, len(lines))
+		}
+		data = []byte(strings.Join(lines[start-1:end], ""))
+	}
+
+	if len(data) > maxReadBytes {
+		return string(data[:maxReadBytes]) + fmt.Sprintf("\n... truncated, %d bytes not shown; read a line range", len(data)-maxReadBytes), nil
+	}
+	return string(data), nil
+}
+
+func (t *Toolbox) grep(pattern, path string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	root, err := t.resolve(path)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || len(matches) >= maxGrepMatches {
+			return nil
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if p != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 && t.within(p, p) != nil {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+
+		rel, _ := filepath.Rel(t.Dir, p)
+		scanner := bufio.NewScanner(f)
+		for n := 1; scanner.Scan(); n++ {
+			line := scanner.Text()
+			if strings.IndexByte(line, 0) >= 0 {
+				return nil // binary file
+			}
+			if re.MatchString(line) {
+				matches = append(matches, fmt.Sprintf("%s:%d: %s", rel, n, line))
+				if len(matches) >= maxGrepMatches {
+					break
+				}
+			}
+		}
+		return nil
+	})
+
+	if len(matches) == 0 {
+		return "no matches", nil
+	}
+	sort.Strings(matches)
+	out := strings.Join(matches, "\n")
+	if len(matches) >= maxGrepMatches {
+		out += fmt.Sprintf("\n... stopped after %d matches, narrow the pattern or path", maxGrepMatches)
+	}
+	return out, nil
+}
+
+func (t *Toolbox) goDoc(ctx context.Context, query string) (string, error) {
+	if query == "" || strings.HasPrefix(query, "-") {
+		return "", fmt.Errorf("invalid query %q", query)
+	}
+	ctx, cancel := context.WithTimeout(ctx, goDocTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "go", "doc", query)
+	cmd.Dir = t.Dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("go doc %s: %v\n%s", query, err, out)
+	}
+	return string(out), nil
+}
@@ -2,28 +2,66 @@ package anthropic
 
 import (
 	"aaai/prompt"
+	"aaai/provider"
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
 const (
+	DefaultModel       = "claude-3-7-sonnet-20250219"
 	DefaultAPIEndpoint = "https://api.anthropic.com/v1/messages"
 )
 
+// Models lists the models this client can be configured with.
+var Models = []provider.ModelInfo{
+	{Name: "claude-3-7-sonnet-20250219", ContextWindow: 200000, MaxOutputTokens: 8192},
+	{Name: "claude-sonnet-4-20250514", ContextWindow: 200000, MaxOutputTokens: 64000},
+	{Name: "claude-opus-4-20250514", ContextWindow: 200000, MaxOutputTokens: 32000},
+	{Name: "claude-3-5-sonnet-20241022", ContextWindow: 200000, MaxOutputTokens: 8192},
+	{Name: "claude-3-5-haiku-20241022", ContextWindow: 200000, MaxOutputTokens: 8192},
+}
+
 type Client struct {
 	APIKey     string
+	Endpoint   string
+	ModelName  string
+	MaxTokens  int
+	Retry      provider.RetryPolicy
 	HTTPClient *http.Client
 }
 
 type CompletionRequest struct {
 	Model     string    `json:"model"`
+	System    []Content `json:"system,omitempty"`
 	Messages  []Message `json:"messages"`
 	MaxTokens int       `json:"max_tokens"`
 	Stream    bool      `json:"stream"`
+	Tools     []Tool    `json:"tools,omitempty"`
+	Thinking  *Thinking `json:"thinking,omitempty"`
+}
+
+// Thinking enables extended thinking with a budget of output tokens.
+type Thinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// MinThinkingBudget is the smallest thinking budget the API accepts.
+const MinThinkingBudget = 1024
+
+// Tool declares a function with a JSON Schema for its input.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
 }
 
 type Message struct {
@@ -32,11 +70,38 @@ type Message struct {
 }
 
 type Content struct {
-	Type     string    `json:"type"`
-	Text     string    `json:"text,omitempty"`
-	Document *Document `json:"document,omitempty"`
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+
+	// document and image blocks
+	*Document
+
+	// CacheControl marks the end of a prefix the API should cache.
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+
+	// thinking and redacted_thinking blocks
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+
+	// tool_use blocks
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result blocks
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+type CacheControl struct {
+	Type string `json:"type"`
 }
 
+// ephemeral is the only cache type, kept for five minutes after last use.
+var ephemeral = &CacheControl{Type: "ephemeral"}
+
 type Document struct {
 	Source Source `json:"source"`
 }
@@ -60,57 +125,196 @@ type ErrorResponse struct {
 func NewClient(apiKey string) *Client {
 	return &Client{
 		APIKey:     apiKey,
+		Endpoint:   DefaultAPIEndpoint,
+		ModelName:  DefaultModel,
+		MaxTokens:  8192,
+		Retry:      provider.DefaultRetryPolicy,
 		HTTPClient: &http.Client{},
 	}
 }
 
-func (c *Client) Complete(promptString string) (string, error) {
-	req := CompletionRequest{
-		Model:  "claude-3-7-sonnet-20250219",
-		Stream: true,
-		Messages: []Message{
-			{
-				Role: "user",
-				Content: []Content{
-					{
-						Type: "text",
-						Text: promptString,
-					},
-				},
-			},
-		},
-		MaxTokens: 8192,
+func init() {
+	provider.Register("anthropic", func(opts provider.Options) provider.Provider {
+		c := NewClient(opts.APIKey)
+		if opts.BaseURL != "" {
+			c.Endpoint = strings.TrimSuffix(opts.BaseURL, "/") + "/v1/messages"
+		}
+		c.ModelName = opts.Model
+		c.MaxTokens = opts.MaxTokens
+		if opts.Retry.MaxAttempts > 0 {
+			c.Retry = opts.Retry
+		}
+		if opts.HTTPClient != nil {
+			c.HTTPClient = opts.HTTPClient
+		}
+		return c
+	}, Models...)
+}
+
+func (c *Client) Name() string {
+	return "anthropic"
+}
+
+func (c *Client) Model() provider.ModelInfo {
+	if info, ok := provider.FindModel(provider.Models("anthropic"), c.ModelName); ok {
+		return info
 	}
+	return provider.ModelInfo{Name: c.ModelName, MaxOutputTokens: c.MaxTokens}
+}
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return "", fmt.Errorf("error marshaling request: %w", err)
+func (c *Client) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Streaming:    true,
+		SystemPrompt: true,
+		Tools:        true,
+		Attachments:  true,
+		Reasoning:    true,
+	}
+}
+
+func messages(conv *prompt.Conversation) []Message {
+	msgs := make([]Message, 0, len(conv.Messages))
+	for _, m := range conv.Messages {
+		var content []Content
+		// Thinking blocks must come first in an assistant message and
+		// tool results first in a user message.
+		for _, t := range m.Thinking {
+			if t.Data != "" {
+				content = append(content, Content{Type: "redacted_thinking", Data: t.Data})
+				continue
+			}
+			content = append(content, Content{Type: "thinking", Thinking: t.Text, Signature: t.Signature})
+		}
+		for _, r := range m.ToolResults {
+			content = append(content, Content{
+				Type:      "tool_result",
+				ToolUseID: r.ToolCallID,
+				Content:   r.Content,
+				IsError:   r.IsError,
+			})
+		}
+		// Attachments go before the text that asks about them.
+		for _, a := range m.Attachments {
+			typ := "document"
+			if a.IsImage() {
+				typ = "image"
+			}
+			content = append(content, Content{
+				Type: typ,
+				Document: &Document{Source: Source{
+					Type:      "base64",
+					MediaType: a.MediaType,
+					Data:      base64.StdEncoding.EncodeToString(a.Data),
+				}},
+			})
+		}
+		if m.Content != "" {
+			content = append(content, Content{Type: "text", Text: m.Content})
+		}
+		for _, call := range m.ToolCalls {
+			content = append(content, Content{
+				Type:  "tool_use",
+				ID:    call.ID,
+				Name:  call.Name,
+				Input: call.Input,
+			})
+		}
+		msgs = append(msgs, Message{Role: m.Role, Content: content})
+	}
+	// Caching up to the last message lets the next turn read the whole
+	// history from the cache.
+	if n := len(msgs); n > 0 && len(msgs[n-1].Content) > 0 {
+		last := msgs[n-1].Content
+		last[len(last)-1].CacheControl = ephemeral
+	}
+	return msgs
+}
+
+// system splits the system prompt and the file context into blocks, with
+// cache breakpoints after the system prompt, after the files unchanged
+// since the previous request and after the last file. Together with the
+// one on the last message that is the API's limit of four.
+func system(conv *prompt.Conversation) []Content {
+	var blocks []Content
+	if conv.System != "" {
+		blocks = append(blocks, Content{Type: "text", Text: conv.System, CacheControl: ephemeral})
+	}
+	for i, text := range conv.Context {
+		b := Content{Type: "text", Text: text}
+		if i == conv.StableContext-1 || i == len(conv.Context)-1 {
+			b.CacheControl = ephemeral
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+func tools(conv *prompt.Conversation) []Tool {
+	var out []Tool
+	for _, t := range conv.Tools {
+		out = append(out, Tool{
+			Name:        t.Name,
+			Description: t.Description,
+			InputSchema: t.InputSchema,
+		})
+	}
+	return out
+}
+
+func (c *Client) Complete(ctx context.Context, conv *prompt.Conversation) (*provider.Response, error) {
+	return c.Stream(ctx, conv, nil)
+}
+
+func (c *Client) Stream(ctx context.Context, conv *prompt.Conversation, h prompt.Handler) (*provider.Response, error) {
+	req := CompletionRequest{
+		Model:     c.ModelName,
+		Stream:    true,
+		System:    system(conv),
+		Messages:  messages(conv),
+		Tools:     tools(conv),
+		MaxTokens: c.MaxTokens,
+	}
+	if budget := conv.ReasoningBudget; budget > 0 {
+		if budget < MinThinkingBudget {
+			return nil, fmt.Errorf("reasoning budget %d is below the minimum of %d", budget, MinThinkingBudget)
+		}
+		if budget >= c.MaxTokens {
+			return nil, fmt.Errorf("reasoning budget %d must be less than max tokens %d", budget, c.MaxTokens)
+		}
+		req.Thinking = &Thinking{Type: "enabled", BudgetTokens: budget}
 	}
 
-	request, err := http.NewRequest("POST", DefaultAPIEndpoint, bytes.NewBuffer(jsonData))
+	jsonData, err := json.Marshal(req)
 	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
+		return nil, fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("X-Api-Key", c.APIKey)
-	request.Header.Set("anthropic-version", "2023-06-01")
+	response, err := provider.Do(ctx, c.HTTPClient, c.Retry, func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, err
+		}
 
-	response, err := c.HTTPClient.Do(request)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("X-Api-Key", c.APIKey)
+		request.Header.Set("anthropic-version", "2023-06-01")
+		return request, nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("error making request: %w", err)
+		return nil, err
 	}
 	defer response.Body.Close()
 
 	reader := bufio.NewReader(response.Body)
-	parser := prompt.NewStreamParser()
+	parser := prompt.NewStreamParser(h)
 	for {
 		line, err := reader.ReadBytes('\n')
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return "", fmt.Errorf("error reading stream: %w", err)
+			resp, _ := provider.Result(parser)
+			return resp, fmt.Errorf("error reading stream: %w", err)
 		}
 
 		if len(line) == 0 {
@@ -126,8 +330,14 @@ func (c *Client) Complete(promptString string) (string, error) {
 		if string(data) == "[DONE]\n" {
 			break
 		}
-		parser.ProcessLine(string(data))
-		//fmt.Println(string(data))
+		if err := parser.ProcessLine(string(data)); err != nil {
+			resp, _ := provider.Result(parser)
+			var se *prompt.StreamError
+			if errors.As(err, &se) {
+				return resp, provider.EventError(se.Type, se.Message)
+			}
+			return resp, err
+		}
 	}
-	return parser.Result(), nil
+	return provider.Result(parser)
 }
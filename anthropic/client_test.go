@@ -0,0 +1,209 @@
+package anthropic
+
+import (
+	"aaai/prompt"
+	"aaai/provider"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const toolUseStream = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":50,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me look."}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_01","name":"read_file","input":{}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"path\": \"ma"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"in.go\"}"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":1}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":30}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+
+func TestToolUse(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "key" {
+			t.Errorf("missing api key header")
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, toolUseStream)
+	}))
+	defer server.Close()
+
+	c := NewClient("key")
+	c.Endpoint = server.URL
+
+	conv := prompt.NewConversation()
+	conv.Tools = []prompt.Tool{{
+		Name:        "read_file",
+		Description: "Read a file",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"}},"required":["path"]}`),
+	}}
+	conv.AddUser("what is in main.go?")
+	conv.AddToolCalls("", []prompt.ToolCall{{ID: "toolu_00", Name: "read_file", Input: json.RawMessage(`{"path":"go.mod"}`)}}, nil)
+	conv.AddToolResults([]prompt.ToolResult{{ToolCallID: "toolu_00", Content: "module aaai"}})
+
+	resp, err := c.Stream(context.Background(), conv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StopReason != provider.StopToolUse || resp.Text != "Let me look." {
+		t.Errorf("got %+v", resp)
+	}
+	want := []prompt.ToolCall{{ID: "toolu_01", Name: "read_file", Input: json.RawMessage(`{"path": "main.go"}`)}}
+	if !reflect.DeepEqual(resp.ToolCalls, want) {
+		t.Errorf("got tool calls %s, want %s", resp.ToolCalls, want)
+	}
+
+	sent, _ := json.Marshal(got)
+	for _, s := range []string{
+		`"input_schema":{"properties"`,
+		`{"id":"toolu_00","input":{"path":"go.mod"},"name":"read_file","type":"tool_use"}`,
+		`{"cache_control":{"type":"ephemeral"},"content":"module aaai","tool_use_id":"toolu_00","type":"tool_result"}`,
+	} {
+		if !strings.Contains(string(sent), s) {
+			t.Errorf("request missing %s:\n%s", s, sent)
+		}
+	}
+}
+
+func TestThinking(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		for _, data := range []string{
+			`{"type":"message_start","message":{"usage":{"input_tokens":20,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Rename it."}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"EqQB"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Done."}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":12}}`,
+			`{"type":"message_stop"}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient("key")
+	c.Endpoint = server.URL
+
+	conv := prompt.NewConversation()
+	conv.ReasoningBudget = 2048
+	conv.AddUser("rename foo")
+	conv.AddToolCalls("", []prompt.ToolCall{{ID: "toolu_00", Name: "grep", Input: json.RawMessage(`{}`)}},
+		[]prompt.ThinkingBlock{{Text: "Search first.", Signature: "Ep8B"}, {Data: "c2VjcmV0"}})
+	conv.AddToolResults([]prompt.ToolResult{{ToolCallID: "toolu_00", Content: "foo.go:1"}})
+
+	resp, err := c.Stream(context.Background(), conv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "Done." || resp.Reasoning != "Rename it." {
+		t.Errorf("got text %q, reasoning %q", resp.Text, resp.Reasoning)
+	}
+	if want := []prompt.ThinkingBlock{{Text: "Rename it.", Signature: "EqQB"}}; !reflect.DeepEqual(resp.Thinking, want) {
+		t.Errorf("got thinking %+v, want %+v", resp.Thinking, want)
+	}
+
+	sent, _ := json.Marshal(got)
+	for _, s := range []string{
+		`"thinking":{"budget_tokens":2048,"type":"enabled"}`,
+		`"content":[{"signature":"Ep8B","thinking":"Search first.","type":"thinking"},{"data":"c2VjcmV0","type":"redacted_thinking"},{"id":"toolu_00"`,
+	} {
+		if !strings.Contains(string(sent), s) {
+			t.Errorf("request missing %s:\n%s", s, sent)
+		}
+	}
+
+	conv.ReasoningBudget = c.MaxTokens
+	if _, err := c.Stream(context.Background(), conv, nil); err == nil {
+		t.Error("expected error for a budget not below max tokens")
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	conv := prompt.NewConversation()
+	conv.System = "edit code"
+	conv.Context = []string{"a.go", "b.go", "c.go"}
+	conv.StableContext = 2
+	conv.AddUser("first")
+	conv.AddAssistant("done")
+	conv.AddUser("second")
+
+	var marked []string
+	for _, b := range system(conv) {
+		if b.CacheControl != nil {
+			marked = append(marked, b.Text)
+		}
+	}
+	for _, m := range messages(conv) {
+		for _, b := range m.Content {
+			if b.CacheControl != nil {
+				marked = append(marked, b.Text)
+			}
+		}
+	}
+	if want := []string{"edit code", "b.go", "c.go", "second"}; !reflect.DeepEqual(marked, want) {
+		t.Errorf("got breakpoints after %q, want %q", marked, want)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	conv := prompt.NewConversation()
+	conv.AddUser("match this design",
+		prompt.Attachment{Filename: "spec.pdf", MediaType: "application/pdf", Data: []byte("%PDF")},
+		prompt.Attachment{Filename: "ui.png", MediaType: "image/png", Data: []byte("png")})
+
+	sent, _ := json.Marshal(messages(conv))
+	want := `[{"role":"user","content":[` +
+		`{"type":"document","source":{"type":"base64","media_type":"application/pdf","data":"JVBERg=="}},` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/png","data":"cG5n"}},` +
+		`{"type":"text","text":"match this design","cache_control":{"type":"ephemeral"}}]}]`
+	if string(sent) != want {
+		t.Errorf("got\n%s\nwant\n%s", sent, want)
+	}
+}
+
+func TestConfiguredModel(t *testing.T) {
+	if err := provider.AddModels("anthropic", provider.ModelInfo{Name: "claude-test-configured", ContextWindow: 100000, MaxOutputTokens: 4096}); err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient("key")
+	c.ModelName = "claude-test-configured"
+	if got := c.Model(); got.ContextWindow != 100000 {
+		t.Errorf("got %+v, want the configured context window", got)
+	}
+}
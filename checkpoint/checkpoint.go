@@ -0,0 +1,206 @@
+// Package checkpoint records the files an applied response changed so that
+// the edit can be undone. In a git work tree every edit is also committed,
+// and undoing it removes the commit again.
+package checkpoint
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNothingToUndo is returned by Undo when no edit is left to undo.
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// Checkpoint holds the contents of the files of one edit from before and
+// after it was applied.
+type Checkpoint struct {
+	// Files are slash separated paths relative to the Store's directory.
+	Files []string
+
+	// Commit is the hash of the git commit of the edit, if any.
+	Commit string
+
+	before, after map[string]snapshot
+}
+
+// snapshot is a file's content, or its absence.
+type snapshot struct {
+	data   []byte
+	exists bool
+}
+
+// Store keeps the checkpoints of a session, newest last.
+type Store struct {
+	Dir string
+
+	// Git is set when Dir is inside a git work tree.
+	Git bool
+
+	stack []*Checkpoint
+}
+
+// New returns a Store for dir, committing edits if dir is in a git work
+// tree and git is installed.
+func New(dir string) *Store {
+	s := &Store{Dir: dir}
+	out, err := s.git("rev-parse", "--is-inside-work-tree")
+	s.Git = err == nil && out == "true"
+	return s
+}
+
+// Begin records the current contents of files, which are about to be
+// edited.
+func (s *Store) Begin(files []string) *Checkpoint {
+	cp := &Checkpoint{before: map[string]snapshot{}}
+	for _, f := range files {
+		f = filepath.ToSlash(filepath.Clean(f))
+		cp.Files = append(cp.Files, f)
+		cp.before[f] = s.read(f)
+	}
+	sort.Strings(cp.Files)
+	return cp
+}
+
+// Restore puts the files of cp back as they were when Begin was called,
+// undoing a partly applied edit. The checkpoint is not kept.
+func (s *Store) Restore(cp *Checkpoint) error {
+	var errs []error
+	for _, f := range cp.Files {
+		if err := s.write(f, cp.before[f]); err != nil {
+			errs = append(errs, fmt.Errorf("error restoring %s: %w", f, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Commit records the contents of the files after the edit and keeps the
+// checkpoint for Undo. In a git work tree the files are committed with
+// message; other changes, staged or not, are left alone. The checkpoint
+// is kept even when committing fails.
+func (s *Store) Commit(cp *Checkpoint, message string) error {
+	cp.after = map[string]snapshot{}
+	changed := false
+	for _, f := range cp.Files {
+		cp.after[f] = s.read(f)
+		changed = changed || !cp.after[f].equal(cp.before[f])
+	}
+	if !changed {
+		return nil
+	}
+	s.stack = append(s.stack, cp)
+	if !s.Git {
+		return nil
+	}
+
+	if _, err := s.git(append([]string{"add", "-A", "--"}, cp.Files...)...); err != nil {
+		return fmt.Errorf("error committing edit: %w", err)
+	}
+	if _, err := s.git(append([]string{"commit", "-q", "-m", message, "--"}, cp.Files...)...); err != nil {
+		return fmt.Errorf("error committing edit: %w", err)
+	}
+	head, err := s.git("rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("error committing edit: %w", err)
+	}
+	cp.Commit = head
+	return nil
+}
+
+// Undo restores the files of the last edit to their contents before it,
+// refusing if any of them changed since. If the edit was committed and
+// its commit is still HEAD, the commit is removed as well. Undo returns
+// the checkpoint it undid and a description of what it did.
+func (s *Store) Undo() (*Checkpoint, string, error) {
+	if len(s.stack) == 0 {
+		return nil, "", ErrNothingToUndo
+	}
+	cp := s.stack[len(s.stack)-1]
+
+	var modified []string
+	for _, f := range cp.Files {
+		if !s.read(f).equal(cp.after[f]) {
+			modified = append(modified, f)
+		}
+	}
+	if len(modified) > 0 {
+		return nil, "", fmt.Errorf("not undoing, changed since the edit: %s", strings.Join(modified, ", "))
+	}
+
+	if err := s.Restore(cp); err != nil {
+		return nil, "", err
+	}
+	s.stack = s.stack[:len(s.stack)-1]
+
+	done := "restored " + strings.Join(cp.Files, ", ")
+	if cp.Commit == "" {
+		return cp, done, nil
+	}
+	head, err := s.git("rev-parse", "HEAD")
+	if err != nil || head != cp.Commit {
+		return cp, done + "; commit " + short(cp.Commit) + " stays as newer commits follow it", nil
+	}
+	if _, err := s.git("reset", "-q", "--soft", "HEAD~1"); err != nil {
+		return cp, "", fmt.Errorf("%s but could not remove commit %s: %w", done, short(cp.Commit), err)
+	}
+	// Unstage the edit, which the soft reset left in the index.
+	if _, err := s.git(append([]string{"reset", "-q", "--"}, cp.Files...)...); err != nil {
+		return cp, "", fmt.Errorf("%s but could not unstage the edit: %w", done, err)
+	}
+	return cp, done + " and removed commit " + short(cp.Commit), nil
+}
+
+func (s *Store) read(f string) snapshot {
+	data, err := os.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(f)))
+	if err != nil {
+		return snapshot{}
+	}
+	return snapshot{data: data, exists: true}
+}
+
+func (s *Store) write(f string, snap snapshot) error {
+	path := filepath.Join(s.Dir, filepath.FromSlash(f))
+	if !snap.exists {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, snap.data, 0644)
+}
+
+func (a snapshot) equal(b snapshot) bool {
+	return a.exists == b.exists && bytes.Equal(a.data, b.data)
+}
+
+// git runs a git command in the store's directory and returns its trimmed
+// output.
+func (s *Store) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = s.Dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func short(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
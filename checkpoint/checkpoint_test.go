@@ -0,0 +1,149 @@
+package checkpoint
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// edit applies changes, mapping paths to new contents or "" to delete, as
+// one checkpointed edit.
+func edit(t *testing.T, s *Store, changes map[string]string) *Checkpoint {
+	t.Helper()
+	var files []string
+	for f := range changes {
+		files = append(files, f)
+	}
+	cp := s.Begin(files)
+	for f, content := range changes {
+		path := filepath.Join(s.Dir, f)
+		if content == "" {
+			os.Remove(path)
+			continue
+		}
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	if err := s.Commit(cp, "aaai: edit"); err != nil {
+		t.Fatal(err)
+	}
+	return cp
+}
+
+func read(t *testing.T, dir, f string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, f))
+	if os.IsNotExist(err) {
+		return "<missing>"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUndo(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.go"), []byte("a1"), 0644)
+	os.WriteFile(filepath.Join(dir, "gone.go"), []byte("gone"), 0644)
+	s := &Store{Dir: dir}
+
+	edit(t, s, map[string]string{"a.go": "a2"})
+	edit(t, s, map[string]string{"a.go": "a3", "sub/new.go": "new", "gone.go": ""})
+
+	if _, _, err := s.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	for f, want := range map[string]string{"a.go": "a2", "sub/new.go": "<missing>", "gone.go": "gone"} {
+		if got := read(t, dir, f); got != want {
+			t.Errorf("%s = %q after first undo, want %q", f, got, want)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.go"), []byte("mine"), 0644)
+	if _, _, err := s.Undo(); err == nil || !strings.Contains(err.Error(), "a.go") {
+		t.Errorf("got %v, want refusal naming a.go", err)
+	}
+	if got := read(t, dir, "a.go"); got != "mine" {
+		t.Errorf("refused undo changed a.go to %q", got)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.go"), []byte("a2"), 0644)
+	if _, _, err := s.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, dir, "a.go"); got != "a1" {
+		t.Errorf("a.go = %q after second undo, want a1", got)
+	}
+	if _, _, err := s.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("got %v, want ErrNothingToUndo", err)
+	}
+}
+
+func TestUnchangedEditIsNotKept(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.go"), []byte("a"), 0644)
+	s := &Store{Dir: dir}
+
+	edit(t, s, map[string]string{"a.go": "a"})
+	if _, _, err := s.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("got %v, want ErrNothingToUndo", err)
+	}
+}
+
+func TestGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("config", "user.name", "test")
+	git("config", "user.email", "test@example.com")
+	os.WriteFile(filepath.Join(dir, "a.go"), []byte("a1"), 0644)
+	os.WriteFile(filepath.Join(dir, "staged.go"), []byte("s1"), 0644)
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	base := git("rev-parse", "HEAD")
+
+	// Work the user has staged stays out of the edit's commit.
+	os.WriteFile(filepath.Join(dir, "staged.go"), []byte("s2"), 0644)
+	git("add", "staged.go")
+
+	s := New(dir)
+	if !s.Git {
+		t.Fatal("work tree not detected")
+	}
+	cp := edit(t, s, map[string]string{"a.go": "a2", "new.go": "new"})
+	if cp.Commit == "" || git("rev-parse", "HEAD") != cp.Commit {
+		t.Fatalf("edit not committed: %+v", cp)
+	}
+	if files := git("show", "--name-only", "--format=", "HEAD"); files != "a.go\nnew.go" {
+		t.Errorf("commit has files %q", files)
+	}
+
+	if _, done, err := s.Undo(); err != nil || !strings.Contains(done, "removed commit") {
+		t.Fatalf("got %q, %v", done, err)
+	}
+	if head := git("rev-parse", "HEAD"); head != base {
+		t.Errorf("HEAD is %s, want %s", head, base)
+	}
+	if status := git("status", "--porcelain"); status != "M  staged.go" {
+		t.Errorf("status after undo:\n%s", status)
+	}
+	if got := read(t, dir, "a.go"); got != "a1" {
+		t.Errorf("a.go = %q after undo", got)
+	}
+}
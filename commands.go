@@ -0,0 +1,301 @@
+package main
+
+import (
+	"aaai/ignore"
+	"aaai/prompt"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// command is run by typing /name followed by its arguments at the prompt.
+type command struct {
+	name string
+	args string
+	help string
+
+	// files tells the completer that the arguments are paths.
+	files bool
+
+	run func(s *session, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "add", args: "<glob>...", help: "add files to the chat, to be sent with every request", files: true, run: (*session).add},
+		{name: "drop", args: "[glob]...", help: "remove files from the chat, or all of them", files: true, run: (*session).drop},
+		{name: "ls", help: "list the files in the chat with their token counts", run: (*session).ls},
+		{name: "read-only", args: "<glob>...", help: "add files to the chat for reference only", files: true, run: (*session).readOnly},
+		{name: "attach", args: "<path>", help: "attach a PDF or image to the next request", files: true, run: (*session).attachCommand},
+		{name: "why", args: "<path>", help: "show why a file is or isn't sent", files: true, run: (*session).why},
+		{name: "undo", help: "revert the files changed by the last applied answer", run: (*session).undo},
+		{name: "clear", help: "forget the conversation so far", run: (*session).clear},
+		{name: "help", help: "list the commands", run: (*session).help},
+	}
+}
+
+func lookup(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// command runs a line starting with a slash.
+func (s *session) command(line string) error {
+	fields := strings.Fields(strings.TrimPrefix(line, "/"))
+	if len(fields) == 0 {
+		return errors.New("missing command, see /help")
+	}
+	c := lookup(fields[0])
+	if c == nil {
+		return fmt.Errorf("unknown command /%s, see /help", fields[0])
+	}
+	return c.run(s, fields[1:])
+}
+
+func (s *session) add(args []string) error {
+	return s.addFiles(args, false)
+}
+
+func (s *session) readOnly(args []string) error {
+	return s.addFiles(args, true)
+}
+
+// addFiles puts the files matching globs in the chat.
+func (s *session) addFiles(globs []string, readOnly bool) error {
+	if len(globs) == 0 {
+		return errors.New("name the files to add")
+	}
+	for _, glob := range globs {
+		paths, err := s.match(glob)
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("no files match %s", glob)
+		}
+		for _, path := range paths {
+			s.chat[path] = readOnly
+			if readOnly {
+				fmt.Printf("added %s read-only\n", path)
+			} else {
+				fmt.Printf("added %s\n", path)
+			}
+		}
+	}
+	return nil
+}
+
+// match returns the files that glob, a pattern as in .gitignore, selects
+// in the repository. A path without wildcards names a file even if it is
+// ignored.
+func (s *session) match(glob string) ([]string, error) {
+	clean := filepath.ToSlash(filepath.Clean(glob))
+	if !filepath.IsLocal(clean) {
+		return nil, fmt.Errorf("%s is outside the repository", glob)
+	}
+	if !strings.ContainsAny(glob, "*?[") {
+		if info, err := os.Stat(filepath.Join(s.dir, clean)); err == nil && !info.IsDir() {
+			return []string{clean}, nil
+		}
+	}
+	p, err := ignore.Parse(glob, "", glob)
+	if err != nil || p == nil {
+		return nil, fmt.Errorf("invalid pattern %q", glob)
+	}
+	var paths []string
+	for _, path := range prompt.ListFiles(s.dir) {
+		if matchPath(p, path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// matchPath reports whether p matches path or one of its directories.
+func matchPath(p *ignore.Pattern, path string) bool {
+	if p.Match(path, false) {
+		return true
+	}
+	for dir := filepath.ToSlash(filepath.Dir(path)); dir != "."; dir = filepath.ToSlash(filepath.Dir(dir)) {
+		if p.Match(dir, true) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *session) drop(args []string) error {
+	if len(args) == 0 {
+		clear(s.chat)
+		fmt.Println("dropped all files")
+		return nil
+	}
+	for _, glob := range args {
+		p, err := ignore.Parse(glob, "", glob)
+		if err != nil || p == nil {
+			return fmt.Errorf("invalid pattern %q", glob)
+		}
+		clean := filepath.ToSlash(filepath.Clean(glob))
+		dropped := false
+		for _, path := range s.chatPaths() {
+			if path == clean || matchPath(p, path) {
+				delete(s.chat, path)
+				fmt.Printf("dropped %s\n", path)
+				dropped = true
+			}
+		}
+		if !dropped {
+			return fmt.Errorf("no files in the chat match %s", glob)
+		}
+	}
+	return nil
+}
+
+func (s *session) ls(args []string) error {
+	if len(s.chat) == 0 {
+		fmt.Println("no files in the chat; files are chosen for each request")
+		return nil
+	}
+	total := 0
+	for _, path := range s.chatPaths() {
+		content, err := os.ReadFile(filepath.Join(s.dir, path))
+		if err != nil {
+			fmt.Printf("  %-40s missing\n", path)
+			continue
+		}
+		tokens := prompt.EstimateTokens(string(content))
+		total += tokens
+		note := ""
+		if s.chat[path] {
+			note = " (read-only)"
+		}
+		fmt.Printf("  %-40s %7d tokens%s\n", path, tokens, note)
+	}
+	fmt.Printf("  %-40s %7d tokens\n", "total", total)
+	return nil
+}
+
+func (s *session) attachCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: /attach <path>")
+	}
+	return s.attach(args[0])
+}
+
+func (s *session) why(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: /why <path>")
+	}
+	why, err := prompt.Explain(s.dir, args[0])
+	if err != nil {
+		return err
+	}
+	if readOnly, ok := s.chat[filepath.ToSlash(filepath.Clean(args[0]))]; ok {
+		why += "; it is in the chat"
+		if readOnly {
+			why += " read-only"
+		}
+	}
+	fmt.Println(why)
+	return nil
+}
+
+func (s *session) undo(args []string) error {
+	cp, done, err := s.checkpoints.Undo()
+	if err != nil {
+		return err
+	}
+	fmt.Println(done)
+	s.notes = append(s.notes, "Your edits to "+strings.Join(cp.Files, ", ")+" were undone; those files are back as they were before them.")
+	return nil
+}
+
+func (s *session) clear(args []string) error {
+	s.conv.Messages = nil
+	fmt.Println("conversation cleared")
+	return nil
+}
+
+func (s *session) help(args []string) error {
+	for _, c := range commands {
+		usage := "/" + c.name
+		if c.args != "" {
+			usage += " " + c.args
+		}
+		fmt.Printf("  %-24s %s\n", usage, c.help)
+	}
+	fmt.Printf("  %-24s %s\n", ".", "send the lines typed so far")
+	return nil
+}
+
+// chatPaths returns the files in the chat in order.
+func (s *session) chatPaths() []string {
+	paths := make([]string, 0, len(s.chat))
+	for path := range s.chat {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// completer completes command names and the paths they take.
+type completer struct {
+	s *session
+}
+
+func (c completer) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+	if !strings.HasPrefix(text, "/") {
+		return nil, 0
+	}
+
+	var candidates []string
+	space := strings.LastIndexByte(text, ' ')
+	word := text[space+1:]
+	if space < 0 {
+		for _, cmd := range commands {
+			candidates = append(candidates, "/"+cmd.name+" ")
+		}
+	} else if cmd := lookup(strings.Fields(text)[0][1:]); cmd != nil && cmd.files {
+		candidates = completePath(prompt.ListFiles(c.s.dir), word)
+	}
+
+	var out [][]rune
+	for _, cand := range candidates {
+		if strings.HasPrefix(cand, word) {
+			out = append(out, []rune(cand[len(word):]))
+		}
+	}
+	return out, len([]rune(word))
+}
+
+// completePath offers the paths starting with prefix, stopping at the
+// next directory so that large trees are completed a level at a time.
+func completePath(paths []string, prefix string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, path := range paths {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		if i := strings.IndexByte(path[len(prefix):], '/'); i >= 0 {
+			path = path[:len(prefix)+i+1]
+		} else {
+			path += " "
+		}
+		if !seen[path] {
+			seen[path] = true
+			out = append(out, path)
+		}
+	}
+	return out
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"aaai/agent"
+	"aaai/mock"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	return dir
+}
+
+func TestCommands(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		".gitignore":     "gen/\n",
+		"main.go":        "package main",
+		"util/util.go":   "package util",
+		"util/README.md": "# util",
+		"gen/api.go":     "package gen",
+	})
+	os.WriteFile(filepath.Join(filepath.Dir(dir), "secret.go"), []byte("package secret"), 0644)
+	sess := newSession(dir, nil)
+
+	steps := []struct {
+		line string
+		chat map[string]bool
+		err  string
+	}{
+		{"/add *.go", map[string]bool{"main.go": false, "util/util.go": false}, ""},
+		{"/read-only util", map[string]bool{"main.go": false, "util/util.go": true, "util/README.md": true}, ""},
+		{"/drop util/*.md", map[string]bool{"main.go": false, "util/util.go": true}, ""},
+		{"/add gen/api.go", map[string]bool{"main.go": false, "util/util.go": true, "gen/api.go": false}, ""},
+		{"/add missing.go", nil, "no files match missing.go"},
+		{"/add ../secret.go", nil, "../secret.go is outside the repository"},
+		{"/read-only " + filepath.Join(filepath.Dir(dir), "secret.go"), nil, "outside the repository"},
+		{"/drop", map[string]bool{}, ""},
+		{"/drop main.go", nil, "no files in the chat match main.go"},
+		{"/ls", map[string]bool{}, ""},
+		{"/add", nil, "name the files to add"},
+		{"/nope", nil, "unknown command /nope"},
+	}
+	for _, step := range steps {
+		err := sess.command(step.line)
+		if step.err != "" {
+			if err == nil || !strings.Contains(err.Error(), step.err) {
+				t.Errorf("%s: got error %v, want %q", step.line, err, step.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", step.line, err)
+		}
+		if !reflect.DeepEqual(sess.chat, step.chat) {
+			t.Errorf("%s: got chat %v, want %v", step.line, sess.chat, step.chat)
+		}
+	}
+
+	sess.conv.AddUser("hi")
+	sess.command("/clear")
+	if len(sess.conv.Messages) != 0 {
+		t.Error("/clear kept the conversation")
+	}
+}
+
+func TestCompleter(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"main.go":       "package main",
+		"util/a.go":     "package util",
+		"util/b.go":     "package util",
+		"util/sub/c.go": "package sub",
+	})
+	c := completer{newSession(dir, nil)}
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"/d", []string{"rop "}},
+		{"/add ", []string{"main.go ", "util/"}},
+		{"/add util/", []string{"a.go ", "b.go ", "sub/"}},
+		{"/add main.go util/s", []string{"ub/"}},
+		{"/clear ", nil},
+		{"hello", nil},
+	}
+	for _, tt := range tests {
+		line := []rune(tt.line)
+		got, _ := c.Do(line, len(line))
+		var s []string
+		for _, r := range got {
+			s = append(s, string(r))
+		}
+		sort.Strings(s)
+		if !reflect.DeepEqual(s, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.line, s, tt.want)
+		}
+	}
+}
+
+func TestSubmitSendsChatFiles(t *testing.T) {
+	path, _ := filepath.Abs(filepath.Join("mock", "testdata", "anthropic_edit.sse"))
+	client, err := mock.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chdir(t)
+
+	dir := writeTree(t, map[string]string{
+		"hello.go": "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n",
+		"other.go": "package main\n\nvar other = 1\n",
+	})
+	sess := newSession(dir, client)
+	if err := sess.command("/add hello.go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.submit(context.Background(), "print hello, world"); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := string(client.Replayer.Requests[0])
+	if !strings.Contains(sent, `fmt.Println(\"hello\")`) || strings.Contains(sent, "var other = 1") {
+		t.Errorf("expected just the chat's files in full:\n%s", sent)
+	}
+}
+
+func TestSubmitGuardsEdits(t *testing.T) {
+	const hello = "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"
+	tests := []struct {
+		name    string
+		add     string
+		confirm bool
+		applied bool
+		note    string
+	}{
+		{"editable", "/add hello.go", false, true, ""},
+		{"read-only", "/read-only hello.go", false, false, "hello.go is read-only"},
+		{"not shown", "/add other.go", false, false, "hello.go was not shown to you"},
+		{"confirmed", "/read-only hello.go", true, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, _ := filepath.Abs(filepath.Join("mock", "testdata", "anthropic_edit.sse"))
+			client, err := mock.New(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chdir(t)
+
+			dir := writeTree(t, map[string]string{"hello.go": hello, "other.go": "package main\n"})
+			sess := newSession(dir, client)
+			var asked []string
+			sess.confirm = func(q string) bool {
+				asked = append(asked, q)
+				return tt.confirm
+			}
+			if err := sess.command(tt.add); err != nil {
+				t.Fatal(err)
+			}
+			if err := sess.submit(context.Background(), "print hello, world"); err != nil {
+				t.Fatal(err)
+			}
+
+			got, _ := os.ReadFile(filepath.Join(dir, "hello.go"))
+			if applied := string(got) != hello; applied != tt.applied {
+				t.Errorf("applied = %v, want %v", applied, tt.applied)
+			}
+			if wantAsked := tt.add != "/add hello.go"; (len(asked) > 0) != wantAsked {
+				t.Errorf("got questions %q, want some: %v", asked, wantAsked)
+			}
+			sent := string(client.Replayer.Requests[0])
+			if readOnly := strings.Contains(sent, "hello.go (read-only)"); readOnly != (tt.add == "/read-only hello.go") {
+				t.Errorf("read-only marker sent: %v", readOnly)
+			}
+			notes := strings.Join(sess.notes, "\n")
+			if tt.note == "" && notes != "" || !strings.Contains(notes, tt.note) {
+				t.Errorf("got notes %q, want %q", notes, tt.note)
+			}
+		})
+	}
+}
+
+func TestAgentKeepsReadOnly(t *testing.T) {
+	const hello = "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"
+	tests := []struct {
+		name string
+		add  string
+		read []string
+	}{
+		{"chat", "/read-only hello.go", nil},
+		{"conventions", "", []string{"hello.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for _, name := range []string{"anthropic_tool_use.sse", "anthropic_edit.sse"} {
+				path, _ := filepath.Abs(filepath.Join("mock", "testdata", name))
+				paths = append(paths, path)
+			}
+			client, err := mock.New(paths...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chdir(t)
+
+			dir := writeTree(t, map[string]string{"hello.go": hello})
+			sess := newSession(dir, client)
+			sess.read = tt.read
+			if sess.agent, err = agent.New(client, dir); err != nil {
+				t.Fatal(err)
+			}
+			if tt.add != "" {
+				if err := sess.command(tt.add); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The model reads hello.go with a tool, then edits it.
+			if err := sess.submit(context.Background(), "print hello, world"); err != nil {
+				t.Fatal(err)
+			}
+			if !sess.agent.Toolbox.Read["hello.go"] {
+				t.Fatal("model did not read hello.go")
+			}
+			if got, _ := os.ReadFile(filepath.Join(dir, "hello.go")); string(got) != hello {
+				t.Errorf("edit to read-only hello.go applied:\n%s", got)
+			}
+			if notes := strings.Join(sess.notes, "\n"); !strings.Contains(notes, "hello.go is read-only") {
+				t.Errorf("got notes %q", notes)
+			}
+		})
+	}
+}
+
+func TestApplyAndUndo(t *testing.T) {
+	chdir(t)
+	dir := writeTree(t, map[string]string{"a.go": "one\ntwo\n"})
+	sess := newSession(dir, nil)
+	edit := "--- a.go\n+++ a.go\n@@ -1,2 +1,2 @@\n one\n-two\n+three\n"
+
+	// A diff that cannot be applied leaves every file as it was.
+	err := sess.apply(map[string]string{"a.go": edit, "missing.go": "--- missing.go\n+++ missing.go\n@@ -1 +1 @@\n-x\n+y\n"}, "aaai: edit")
+	if err == nil {
+		t.Fatal("expected error patching a missing file")
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "a.go")); string(got) != "one\ntwo\n" {
+		t.Errorf("failed edit left a.go as %q", got)
+	}
+
+	if err := sess.apply(map[string]string{"a.go": edit}, "aaai: edit"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "a.go")); string(got) != "one\nthree\n" {
+		t.Fatalf("edit not applied: %q", got)
+	}
+	if err := sess.command("/undo"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "a.go")); string(got) != "one\ntwo\n" {
+		t.Errorf("undo left a.go as %q", got)
+	}
+	if len(sess.notes) != 1 || !strings.Contains(sess.notes[0], "a.go") {
+		t.Errorf("model not told about the undo: %q", sess.notes)
+	}
+	if err := sess.command("/undo"); err == nil {
+		t.Error("expected error with nothing left to undo")
+	}
+}
+
+func TestApplyRejectsStaleDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	chdir(t)
+	dir := writeTree(t, map[string]string{"a.go": "one\ntwo\n", "b.go": "red\ngreen\n"})
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("config", "user.name", "test")
+	git("config", "user.email", "test@example.com")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	head := git("rev-parse", "HEAD")
+
+	sess := newSession(dir, nil)
+	err := sess.apply(map[string]string{
+		"a.go": "--- a.go\n+++ a.go\n@@ -1,2 +1,2 @@\n one\n-two\n+three\n",
+		"b.go": "--- b.go\n+++ b.go\n@@ -1,2 +1,2 @@\n red\n-blue\n+yellow\n",
+	}, "aaai: edit")
+	if err == nil || !strings.Contains(err.Error(), "b.go") {
+		t.Fatalf("got %v, want error naming b.go", err)
+	}
+	if status := git("status", "--porcelain"); status != "" {
+		t.Errorf("stale diff changed files:\n%s", status)
+	}
+	if got := git("rev-parse", "HEAD"); got != head {
+		t.Errorf("stale diff was committed as %s", got)
+	}
+}
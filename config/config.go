@@ -0,0 +1,267 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// FileName is the per-repository config file looked up in the target dir.
+const FileName = ".aaai.yml"
+
+type Config struct {
+	Provider  string
+	Model     string
+	MaxTokens int
+
+	// Agent selects agent mode, where the model explores the repository
+	// with tools instead of receiving every file.
+	Agent bool
+
+	// MaxAttempts bounds how often a rate limited or failed request is
+	// sent; zero keeps the provider default.
+	MaxAttempts int
+
+	// ReasoningBudget is the number of tokens the model may think for
+	// before answering; zero leaves reasoning off.
+	ReasoningBudget int
+
+	// Read lists files, relative to the repository, sent as read-only
+	// context with every request. When empty CONVENTIONS.md is sent if
+	// it exists.
+	Read []string
+
+	// APIKeys holds keys set under api_keys:, by provider name.
+	APIKeys map[string]string
+
+	// Providers holds the entries under providers:, by provider name.
+	Providers map[string]*ProviderConfig
+}
+
+// ProviderConfig customizes how an OpenAI compatible provider is reached.
+// An entry whose name is not a built-in provider defines a new one.
+type ProviderConfig struct {
+	BaseURL         string
+	AuthHeader      string
+	Headers         map[string]string
+	Models          []string
+	ContextWindow   int
+	MaxOutputTokens int
+}
+
+// Default returns the settings used when no config file or flag says
+// otherwise.
+func Default() *Config {
+	return &Config{
+		Provider:  "anthropic",
+		APIKeys:   map[string]string{},
+		Providers: map[string]*ProviderConfig{},
+	}
+}
+
+// Dir returns ~/.aaai, the directory holding user level settings.
+func Dir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".aaai"
+	}
+	return filepath.Join(home, ".aaai")
+}
+
+// Load returns the defaults overridden by ~/.aaai/config.yml and then by
+// the .aaai.yml found in dir. Missing files are ignored.
+func Load(dir string) (*Config, error) {
+	c := Default()
+	for _, path := range []string{
+		filepath.Join(Dir(), "config.yml"),
+		filepath.Join(dir, FileName),
+	} {
+		if err := c.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// LoadFile applies the settings of one config file on top of c.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	m, err := parseYAML(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.apply(m); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) apply(m map[string]any) error {
+	for key, value := range m {
+		switch key {
+		case "provider":
+			s, err := str(key, value)
+			if err != nil {
+				return err
+			}
+			c.Provider = s
+		case "model":
+			s, err := str(key, value)
+			if err != nil {
+				return err
+			}
+			c.Model = s
+		case "max_tokens":
+			n, err := positive(key, value)
+			if err != nil {
+				return err
+			}
+			c.MaxTokens = n
+		case "agent":
+			b, err := boolean(key, value)
+			if err != nil {
+				return err
+			}
+			c.Agent = b
+		case "max_attempts":
+			n, err := positive(key, value)
+			if err != nil {
+				return err
+			}
+			c.MaxAttempts = n
+		case "reasoning_budget":
+			n, err := positive(key, value)
+			if err != nil {
+				return err
+			}
+			c.ReasoningBudget = n
+		case "read":
+			l, err := list(key, value)
+			if err != nil {
+				return err
+			}
+			c.Read = l
+		case "api_keys":
+			keys, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("api_keys must map provider names to keys")
+			}
+			for name, v := range keys {
+				s, err := str("api_keys."+name, v)
+				if err != nil {
+					return err
+				}
+				c.APIKeys[name] = s
+			}
+		case "providers":
+			entries, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("providers must map provider names to settings")
+			}
+			for name, v := range entries {
+				settings, ok := v.(map[string]any)
+				if !ok {
+					return fmt.Errorf("providers.%s must be a mapping", name)
+				}
+				pc := c.Providers[name]
+				if pc == nil {
+					pc = &ProviderConfig{}
+					c.Providers[name] = pc
+				}
+				if err := pc.apply("providers."+name, settings); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return nil
+}
+
+func (pc *ProviderConfig) apply(prefix string, m map[string]any) error {
+	for key, value := range m {
+		name := prefix + "." + key
+		var err error
+		switch key {
+		case "base_url":
+			pc.BaseURL, err = str(name, value)
+		case "auth_header":
+			pc.AuthHeader, err = str(name, value)
+		case "headers":
+			headers, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s must be a mapping", name)
+			}
+			pc.Headers = map[string]string{}
+			for k, v := range headers {
+				if pc.Headers[k], err = str(name+"."+k, v); err != nil {
+					return err
+				}
+			}
+		case "model", "models":
+			pc.Models, err = list(name, value)
+		case "context_window":
+			pc.ContextWindow, err = positive(name, value)
+		case "max_output_tokens":
+			pc.MaxOutputTokens, err = positive(name, value)
+		default:
+			return fmt.Errorf("unknown key %q", name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func positive(key string, value any) (int, error) {
+	s, err := str(key, value)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %q", key, s)
+	}
+	return n, nil
+}
+
+func boolean(key string, value any) (bool, error) {
+	s, err := str(key, value)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got %q", key, s)
+	}
+	return b, nil
+}
+
+// list accepts a list of strings or a single one.
+func list(key string, value any) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%s must be a name or a list of names", key)
+}
+
+func str(key string, value any) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+	return s, nil
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected map[string]any
+		wantErr  bool
+	}{
+		{
+			name: "Scalars and comments",
+			input: `# defaults for this repo
+provider: groq
+model: "llama-3.3-70b-versatile" # fast
+max_tokens: 4096
+`,
+			expected: map[string]any{
+				"provider":   "groq",
+				"model":      "llama-3.3-70b-versatile",
+				"max_tokens": "4096",
+			},
+		},
+		{
+			name: "Lists and nested maps",
+			input: `read:
+  - CONVENTIONS.md
+  - 'docs/style.md'
+providers:
+  local:
+    base_url: http://localhost:8080/v1
+tags: [a, b]
+`,
+			expected: map[string]any{
+				"read": []string{"CONVENTIONS.md", "docs/style.md"},
+				"providers": map[string]any{
+					"local": map[string]any{
+						"base_url": "http://localhost:8080/v1",
+					},
+				},
+				"tags": []string{"a", "b"},
+			},
+		},
+		{
+			name: "Quoted scalars",
+			input: `read: [a.md, "b, c.md", 'it''s.md', "tab\tq\"uote"]
+title: 'it''s'
+path: "C:\\src"
+empty: []
+trailing: [a, b,]
+`,
+			expected: map[string]any{
+				"read":     []string{"a.md", "b, c.md", "it's.md", "tab\tq\"uote"},
+				"title":    "it's",
+				"path":     `C:\src`,
+				"empty":    []string{},
+				"trailing": []string{"a", "b"},
+			},
+		},
+		{name: "Flow mapping", input: "providers: {local: x}\n", wantErr: true},
+		{name: "Block scalar", input: "model: |\n  multi\n", wantErr: true},
+		{name: "Folded scalar", input: "model: >-\n  folded\n", wantErr: true},
+		{name: "Anchor", input: "model: &m qwen\n", wantErr: true},
+		{name: "Unknown escape", input: `model: "a\qb"` + "\n", wantErr: true},
+		{name: "Unterminated quote", input: "model: 'qwen\n", wantErr: true},
+		{name: "Unterminated list quote", input: `read: ["a, b]` + "\n", wantErr: true},
+		{name: "Nested list", input: "read: [[a]]\n", wantErr: true},
+		{name: "List of mappings", input: "read:\n  - path: a.md\n", wantErr: true},
+		{
+			name:    "Bad indentation",
+			input:   "provider: groq\n  model: x\n",
+			wantErr: true,
+		},
+		{
+			name:    "Tab indentation",
+			input:   "providers:\n\tlocal: x\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %#v, want %#v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, FileName)
+
+	c := Default()
+	if err := c.LoadFile(path); err != nil {
+		t.Fatalf("missing file should be ignored: %v", err)
+	}
+
+	os.WriteFile(path, []byte("provider: deepseek\nmax_tokens: 1024\n"), 0644)
+	if err := c.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if c.Provider != "deepseek" || c.MaxTokens != 1024 {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	os.WriteFile(path, []byte("read:\n  - STYLE.md\n  - docs/errors.md\n"), 0644)
+	if err := c.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Read, []string{"STYLE.md", "docs/errors.md"}) {
+		t.Errorf("got read %q", c.Read)
+	}
+
+	os.WriteFile(path, []byte("max_tokens: lots\n"), 0644)
+	if err := c.LoadFile(path); err == nil {
+		t.Error("expected error for non-numeric max_tokens")
+	}
+
+	os.WriteFile(path, []byte("modle: typo\n"), 0644)
+	if err := c.LoadFile(path); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GROQ", "")
+	t.Setenv("DEEPSEEK", "")
+
+	c := Default()
+	if _, err := c.APIKey("groq"); err == nil {
+		t.Fatal("expected error without any key")
+	}
+
+	t.Setenv("GROQ", "from-env")
+	if key, _ := c.APIKey("groq"); key != "from-env" {
+		t.Errorf("got %q, want key from environment", key)
+	}
+
+	path := CredentialsPath()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("deepseek: from-file\n"), 0644)
+	if _, err := c.APIKey("deepseek"); err == nil {
+		t.Error("expected error for world readable credentials file")
+	}
+
+	os.Chmod(path, 0600)
+	if key, err := c.APIKey("deepseek"); err != nil || key != "from-file" {
+		t.Errorf("got %q, %v, want key from credentials file", key, err)
+	}
+
+	c.APIKeys["deepseek"] = "from-config"
+	if key, _ := c.APIKey("deepseek"); key != "from-config" {
+		t.Errorf("got %q, want key from config", key)
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// envVars names the environment variable read for each provider's key.
+// Providers not listed use NAME_API_KEY.
+var envVars = map[string]string{
+	"anthropic": "ANTHROPIC_API_KEY",
+	"deepseek":  "DEEPSEEK",
+	"groq":      "GROQ",
+}
+
+// keyless lists the providers that run locally without credentials.
+var keyless = map[string]bool{
+	"ollama": true,
+}
+
+// EnvVar returns the environment variable holding the key for a provider.
+func EnvVar(provider string) string {
+	if v, ok := envVars[provider]; ok {
+		return v
+	}
+	name := strings.NewReplacer("-", "_", ".", "_").Replace(provider)
+	return strings.ToUpper(name) + "_API_KEY"
+}
+
+// CredentialsPath returns ~/.aaai/credentials.
+func CredentialsPath() string {
+	return filepath.Join(Dir(), "credentials")
+}
+
+// APIKey resolves the key for a provider from, in order, its environment
+// variable, api_keys: in the config files and ~/.aaai/credentials.
+// Local providers and those configured with auth_header: none need no
+// key.
+func (c *Config) APIKey(provider string) (string, error) {
+	if keyless[provider] {
+		return "", nil
+	}
+	if pc := c.Providers[provider]; pc != nil && pc.AuthHeader == "none" {
+		return "", nil
+	}
+
+	env := EnvVar(provider)
+	if key := os.Getenv(env); key != "" {
+		return key, nil
+	}
+	if key := c.APIKeys[provider]; key != "" {
+		return key, nil
+	}
+
+	creds, err := readCredentials(CredentialsPath())
+	if err != nil {
+		return "", err
+	}
+	if key := creds[provider]; key != "" {
+		return key, nil
+	}
+
+	return "", fmt.Errorf("no API key for %s: set the %s environment variable or add \"%s: <key>\" to %s",
+		provider, env, provider, CredentialsPath())
+}
+
+// readCredentials parses a credentials file of "provider: key" lines. The
+// file must not be readable by group or others.
+func readCredentials(path string) (map[string]string, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return nil, fmt.Errorf("%s has permissions %04o, run: chmod 600 %s", path, perm, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	m, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	creds := map[string]string{}
+	for name, v := range m {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: key for %s must be a string", path, name)
+		}
+		creds[name] = s
+	}
+	return creds, nil
+}
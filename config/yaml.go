@@ -0,0 +1,211 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML understands the small subset of YAML used by aaai config
+// files: nested mappings by indentation, lists of scalars, quoted or bare
+// scalar values and # comments. Values are string, []string or
+// map[string]any. Other YAML features, such as flow mappings, block
+// scalars and anchors, are errors rather than being misread.
+func parseYAML(data string) (map[string]any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(data, "\n") {
+		text := stripComment(strings.TrimRight(raw, " \t\r"))
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		lead := text[:len(text)-len(strings.TrimLeft(text, " \t"))]
+		if strings.Contains(lead, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		indent := len(lead)
+		lines = append(lines, yamlLine{num: i + 1, indent: indent, text: strings.TrimSpace(text)})
+	}
+
+	m, rest, err := parseMap(lines, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected indentation", rest[0].num)
+	}
+	return m, nil
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+func parseMap(lines []yamlLine, indent int) (map[string]any, []yamlLine, error) {
+	m := map[string]any{}
+	for len(lines) > 0 {
+		line := lines[0]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+		key, value, ok := strings.Cut(line.text, ":")
+		if !ok || strings.HasPrefix(line.text, "- ") {
+			return nil, nil, fmt.Errorf("line %d: expected key: value", line.num)
+		}
+		key, err := scalar(strings.TrimSpace(key))
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line.num, err)
+		}
+		value = strings.TrimSpace(value)
+		lines = lines[1:]
+
+		if value != "" {
+			v, err := parseScalarOrFlow(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", line.num, err)
+			}
+			m[key] = v
+			continue
+		}
+		if len(lines) == 0 || lines[0].indent < indent ||
+			(lines[0].indent == indent && !strings.HasPrefix(lines[0].text, "- ")) {
+			m[key] = ""
+			continue
+		}
+
+		child := lines[0].indent
+		if strings.HasPrefix(lines[0].text, "- ") || lines[0].text == "-" {
+			var list []string
+			for len(lines) > 0 && lines[0].indent == child && strings.HasPrefix(lines[0].text, "-") {
+				item, err := scalar(strings.TrimSpace(strings.TrimPrefix(lines[0].text, "-")))
+				if err != nil {
+					return nil, nil, fmt.Errorf("line %d: %w", lines[0].num, err)
+				}
+				list = append(list, item)
+				lines = lines[1:]
+			}
+			m[key] = list
+			continue
+		}
+
+		sub, rest, err := parseMap(lines, child)
+		if err != nil {
+			return nil, nil, err
+		}
+		m[key] = sub
+		lines = rest
+	}
+	return m, lines, nil
+}
+
+func parseScalarOrFlow(value string) (any, error) {
+	if !strings.HasPrefix(value, "[") {
+		return scalar(value)
+	}
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("unterminated flow list %s", value)
+	}
+	items, err := splitFlow(value[1 : len(value)-1])
+	if err != nil {
+		return nil, err
+	}
+	list := []string{}
+	for _, item := range items {
+		v, err := scalar(item)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// splitFlow splits the inside of a flow list at the commas outside quotes.
+func splitFlow(inner string) ([]string, error) {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(inner[start:i]))
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in [%s]", inner)
+	}
+	// A trailing comma, or an empty list, leaves nothing after the last
+	// comma.
+	if last := strings.TrimSpace(inner[start:]); last != "" || len(items) == 0 && inner != "" {
+		items = append(items, last)
+	}
+	for _, item := range items {
+		if item == "" {
+			return nil, fmt.Errorf("empty item in [%s]", inner)
+		}
+	}
+	return items, nil
+}
+
+func stripComment(s string) string {
+	inSingle, inDouble := false, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && inDouble:
+			i++
+		case c == '\'' && !inDouble:
+			inSingle = !inSingle
+		case c == '"' && !inSingle:
+			inDouble = !inDouble
+		case c == '#' && !inSingle && !inDouble && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// errUnsupported is returned for YAML the subset doesn't handle, so that
+// a config file never loads with values other than those written.
+var errUnsupported = errors.New("only plain and quoted strings, lists and mappings are supported")
+
+// scalar decodes a plain, single quoted or double quoted scalar.
+func scalar(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	switch s[0] {
+	case '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid double quoted string %s", s)
+		}
+		return v, nil
+	case '\'':
+		inner := strings.TrimSuffix(s[1:], "'")
+		if len(s) < 2 || !strings.HasSuffix(s, "'") || strings.Contains(strings.ReplaceAll(inner, "''", ""), "'") {
+			return "", fmt.Errorf("invalid single quoted string %s", s)
+		}
+		return strings.ReplaceAll(inner, "''", "'"), nil
+	case '[', ']', '{', '}', '|', '>', '&', '*', '!', '@', '`':
+		return "", fmt.Errorf("%s: %w", s, errUnsupported)
+	}
+	if strings.Contains(s, ": ") || strings.HasSuffix(s, ":") {
+		return "", fmt.Errorf("%s: %w", s, errUnsupported)
+	}
+	return s, nil
+}
@@ -10,7 +10,17 @@ import (
 	"strings"
 )
 
+// ApplyPatch applies the unified diff fileDiff, either a path or the diff
+// itself, to fileOrig. It prints any error and exits.
 func ApplyPatch(fileOrig, fileDiff string) {
+	if err := Patch(fileOrig, fileDiff); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// Patch is ApplyPatch returning errors instead of exiting.
+func Patch(fileOrig, fileDiff string) error {
 	var content string
 
 	// Handle the case when fileDiff is actually the content of the diff
@@ -20,8 +30,7 @@ func ApplyPatch(fileOrig, fileDiff string) {
 		var err error
 		content, err = ReadStringFromFile(fileDiff)
 		if err != nil {
-			fmt.Printf("Error reading diff file: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("error reading diff file: %w", err)
 		}
 	}
 
@@ -31,8 +40,7 @@ func ApplyPatch(fileOrig, fileDiff string) {
 	linesOrig, err := readLines(fileOrig)
 	// Only consider missing file an error if it's not a new file creation
 	if err != nil && (!os.IsNotExist(err) || !isNewFile) {
-		fmt.Printf("Error reading original file: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error reading original file: %w", err)
 	}
 
 	if linesOrig == nil {
@@ -41,28 +49,28 @@ func ApplyPatch(fileOrig, fileDiff string) {
 
 	linesDiff, err := readLinesFromString(content)
 	if err != nil {
-		fmt.Printf("Error reading diff: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error reading diff: %w", err)
 	}
 
 	hunks := parseHunks(linesDiff)
-	updatedLines := applyHunks(linesOrig, hunks)
+	updatedLines, skipped := applyHunks(linesOrig, hunks)
+	if len(skipped) > 0 {
+		return fmt.Errorf("error applying diff to %s: context of hunks %v not found", fileOrig, skipped)
+	}
 
 	// Create directory if needed
 	dir := filepath.Dir(fileOrig)
 	if dir != "." && dir != "/" {
 		err = os.MkdirAll(dir, 0755)
 		if err != nil && !os.IsExist(err) {
-			fmt.Printf("Error creating directory: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("error creating directory: %w", err)
 		}
 	}
 
-	err = writeLines(fileOrig, updatedLines)
-	if err != nil {
-		fmt.Printf("Error writing to %s: %v\n", fileOrig, err)
-		os.Exit(1)
+	if err := writeLines(fileOrig, updatedLines); err != nil {
+		return fmt.Errorf("error writing to %s: %w", fileOrig, err)
 	}
+	return nil
 }
 
 type Hunk struct {
@@ -190,9 +198,12 @@ func findHunkPosition(lines []string, hunk Hunk) int {
 	return -1
 }
 
-func applyHunks(original []string, hunks []Hunk) []string {
+// applyHunks returns original with hunks applied, and the numbers,
+// counting from 1, of the hunks whose context was not found.
+func applyHunks(original []string, hunks []Hunk) ([]string, []int) {
 	result := make([]string, len(original))
 	copy(result, original)
+	var skipped []int
 
 	// Apply hunks in order
 	for i, hunk := range hunks {
@@ -210,13 +221,13 @@ func applyHunks(original []string, hunks []Hunk) []string {
 					newFileLines = append(newFileLines, newLine)
 				}
 			}
-			return newFileLines
+			return newFileLines, nil
 		}
 
 		pos := findHunkPosition(result, hunk)
 
 		if pos == -1 {
-			fmt.Printf("Warning: Hunk %d skipped (context not found at line %d)\n", i+1, hunk.StartLine+1)
+			skipped = append(skipped, i+1)
 			continue
 		}
 
@@ -248,7 +259,7 @@ func applyHunks(original []string, hunks []Hunk) []string {
 
 		result = append(before, append(newLines, after...)...)
 	}
-	return result
+	return result, skipped
 }
 
 // Helper function to read file content as a string
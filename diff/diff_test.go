@@ -440,11 +440,19 @@ func TestApplyHunks(t *testing.T) {
 		"line 5\n",
 	}
 
-	result := applyHunks(original, hunks)
+	result, skipped := applyHunks(original, hunks)
 
 	if !reflect.DeepEqual(result, expected) {
 		t.Errorf("Expected:\n%v\nGot:\n%v", expected, result)
 	}
+	if len(skipped) != 0 {
+		t.Errorf("Expected no skipped hunks, got %v", skipped)
+	}
+
+	stale := []Hunk{{StartLine: 0, Length: 1, Lines: []string{"-line 9", "+line nine"}}}
+	if result, skipped := applyHunks(original, stale); !reflect.DeepEqual(skipped, []int{1}) || !reflect.DeepEqual(result, original) {
+		t.Errorf("Expected hunk 1 skipped and lines unchanged, got %v, %v", skipped, result)
+	}
 }
 
 func TestReadLinesFromString(t *testing.T) {
@@ -0,0 +1,286 @@
+// Package ignore decides which files of a repository to leave out, using
+// the rules of .gitignore files.
+//
+// Patterns are read from .gitignore and .aaaiignore files in every
+// directory, from .git/info/exclude, and from built-in defaults for
+// version control and dependency directories. As with git, patterns in
+// deeper directories take precedence over shallower ones, later patterns
+// over earlier ones, .aaaiignore over .gitignore, and a file inside an
+// ignored directory cannot be re-included.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// FileName is the project specific ignore file read next to .gitignore.
+const FileName = ".aaaiignore"
+
+// Defaults are ignored unless a negated pattern re-includes them.
+var Defaults = []string{".git/", "vendor/", "node_modules/"}
+
+// Pattern is one line of an ignore file.
+type Pattern struct {
+	// Source names where the pattern came from, as file:line.
+	Source string
+	Text   string
+
+	negate  bool
+	dirOnly bool
+	base    string // directory the pattern is relative to, "" for the root
+	re      *regexp.Regexp
+}
+
+func (p *Pattern) String() string {
+	return p.Source + ": " + p.Text
+}
+
+// Parse compiles one line of an ignore file found in base, a slash
+// separated directory relative to the root. It returns nil for blank
+// lines and comments.
+func Parse(line, base, source string) (*Pattern, error) {
+	text := trimTrailingSpace(line)
+	if text == "" || strings.HasPrefix(text, "#") {
+		return nil, nil
+	}
+	p := &Pattern{Source: source, Text: text, base: base}
+	if strings.HasPrefix(text, "!") {
+		p.negate = true
+		text = text[1:]
+	} else if strings.HasPrefix(text, `\!`) || strings.HasPrefix(text, `\#`) {
+		text = text[1:]
+	}
+	if strings.HasSuffix(text, "/") {
+		p.dirOnly = true
+		text = strings.TrimRight(text, "/")
+	}
+	if text == "" {
+		return nil, nil
+	}
+
+	// A slash anywhere but the end anchors the pattern to its directory;
+	// otherwise it matches a name at any depth.
+	var expr strings.Builder
+	expr.WriteString("^")
+	if strings.Contains(text, "/") {
+		text = strings.TrimPrefix(text, "/")
+	} else {
+		expr.WriteString("(?:.*/)?")
+	}
+	translate(&expr, text)
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern %q", source, p.Text)
+	}
+	p.re = re
+	return p, nil
+}
+
+// translate writes the regular expression for a glob. As in git, a [
+// without a closing ] is a literal.
+func translate(expr *strings.Builder, glob string) {
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case glob[i:] == "**" && i > 0 && glob[i-1] == '/':
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+}
+
+// trimTrailingSpace removes trailing spaces that are not escaped.
+func trimTrailingSpace(s string) string {
+	s = strings.TrimRight(s, "\r")
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, `\ `) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// Match reports whether the pattern applies to rel, a slash separated
+// path relative to the root, regardless of negation.
+func (p *Pattern) Match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+	return p.re.MatchString(rel)
+}
+
+// Decision explains whether a path is ignored.
+type Decision struct {
+	Ignored bool
+
+	// Pattern is the last pattern that matched, nil if none did. When Dir
+	// is set the pattern matched that parent directory rather than the
+	// path itself.
+	Pattern *Pattern
+	Dir     string
+}
+
+func (d Decision) String() string {
+	switch {
+	case d.Pattern == nil:
+		return "no ignore pattern matches"
+	case d.Dir != "":
+		return fmt.Sprintf("directory %s/ is ignored by %s", d.Dir, d.Pattern)
+	case d.Ignored:
+		return "ignored by " + d.Pattern.String()
+	default:
+		return "re-included by " + d.Pattern.String()
+	}
+}
+
+// Matcher reads the ignore files under a root directory as they are
+// needed.
+type Matcher struct {
+	root string
+
+	mu       sync.Mutex
+	patterns map[string][]*Pattern // by directory
+	errs     []error
+}
+
+// New returns a Matcher for the repository at root.
+func New(root string) *Matcher {
+	m := &Matcher{root: root, patterns: map[string][]*Pattern{}}
+	var ps []*Pattern
+	for _, d := range Defaults {
+		p, _ := Parse(d, "", "default")
+		ps = append(ps, p)
+	}
+	ps = append(ps, m.read(".git/info/exclude", "")...)
+	m.patterns[""] = append(ps, m.load("")...)
+	return m
+}
+
+// Errors returns the problems found reading ignore files so far.
+func (m *Matcher) Errors() []error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.errs
+}
+
+// Ignored reports whether path, relative to the root, is ignored.
+func (m *Matcher) Ignored(path string, isDir bool) bool {
+	return m.Explain(path, isDir).Ignored
+}
+
+// Explain tells whether path, relative to the root, is ignored and which
+// pattern decided it.
+func (m *Matcher) Explain(rel string, isDir bool) Decision {
+	rel = strings.Trim(filepath.ToSlash(filepath.Clean(rel)), "/")
+	if rel == "." || rel == "" {
+		return Decision{}
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		if d := m.decide(dir, true); d.Ignored {
+			d.Dir = dir
+			return d
+		}
+	}
+	return m.decide(rel, isDir)
+}
+
+// decide applies the patterns of every directory above rel, the last
+// match winning.
+func (m *Matcher) decide(rel string, isDir bool) Decision {
+	dirs := []string{""}
+	for i := range len(rel) {
+		if rel[i] == '/' {
+			dirs = append(dirs, rel[:i])
+		}
+	}
+
+	var d Decision
+	for _, dir := range dirs {
+		for _, p := range m.dirPatterns(dir) {
+			if p.Match(rel, isDir) {
+				d = Decision{Ignored: !p.negate, Pattern: p}
+			}
+		}
+	}
+	return d
+}
+
+func (m *Matcher) dirPatterns(dir string) []*Pattern {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ps, ok := m.patterns[dir]
+	if !ok {
+		ps = m.load(dir)
+		m.patterns[dir] = ps
+	}
+	return ps
+}
+
+// load reads the ignore files of dir; the caller holds mu or owns m.
+func (m *Matcher) load(dir string) []*Pattern {
+	var ps []*Pattern
+	for _, name := range []string{".gitignore", FileName} {
+		ps = append(ps, m.read(path.Join(dir, name), dir)...)
+	}
+	return ps
+}
+
+func (m *Matcher) read(name, base string) []*Pattern {
+	f, err := os.Open(filepath.Join(m.root, filepath.FromSlash(name)))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var ps []*Pattern
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		p, err := Parse(scanner.Text(), base, fmt.Sprintf("%s:%d", filepath.ToSlash(name), n))
+		if err != nil {
+			m.errs = append(m.errs, err)
+			continue
+		}
+		if p != nil {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
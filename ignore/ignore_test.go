@@ -0,0 +1,105 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "debug.log", false, true},
+		{"*.log", "logs/debug.log", false, true},
+		{"*.log", "debug.log.txt", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"/build", "src/build", true, false},
+		{"/build", "build", false, true},
+		{"doc/*.txt", "doc/notes.txt", false, true},
+		{"doc/*.txt", "doc/server/arch.txt", false, false},
+		{"doc/*.txt", "src/doc/notes.txt", false, false},
+		{"**/foo", "a/b/foo", false, true},
+		{"**/foo", "foo", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"abc/**", "abc/x/y", false, true},
+		{"abc/**", "abc", true, false},
+		{"file?.go", "file1.go", false, true},
+		{"file[0-9].go", "file7.go", false, true},
+		{"file[!0-9].go", "file7.go", false, false},
+		{`\#notes`, "#notes", false, true},
+		{"trailing   ", "trailing", false, true},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.pattern, "", "test")
+		if err != nil {
+			t.Fatalf("%q: %v", tt.pattern, err)
+		}
+		if got := p.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("%q matching %q (dir %v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+
+	for _, line := range []string{"", "   ", "# comment"} {
+		if p, _ := Parse(line, "", "test"); p != nil {
+			t.Errorf("%q parsed as a pattern", line)
+		}
+	}
+	if p, err := Parse("[abc", "", "test"); err != nil || !p.Match("[abc", false) {
+		t.Errorf("unterminated class not taken literally: %v", err)
+	}
+	if _, err := Parse("[z-a].go", "", "test"); err == nil {
+		t.Error("expected error for an invalid class")
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	write(".gitignore", "*.gen.go\nbuild/\n!keep.gen.go\nsecret/\n")
+	write(".aaaiignore", "testdata/\n")
+	write("pkg/.gitignore", "!*.gen.go\nlocal.go\n")
+	write("pkg/.aaaiignore", "local.go\n!local.go\n")
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+		source  string
+	}{
+		{"main.go", false, false, ""},
+		{"api.gen.go", false, true, ".gitignore:1"},
+		{"keep.gen.go", false, false, ".gitignore:3"},
+		{"pkg/api.gen.go", false, false, "pkg/.gitignore:1"},
+		{"pkg/local.go", false, false, "pkg/.aaaiignore:2"},
+		{"build/out.go", false, true, ".gitignore:2"},
+		{"secret/keep.gen.go", false, true, ".gitignore:4"},
+		{"x/testdata/a.go", false, true, ".aaaiignore:1"},
+		{"vendor/mod/a.go", false, true, "default"},
+		{".git", true, true, "default"},
+	}
+	m := New(root)
+	for _, tt := range tests {
+		d := m.Explain(tt.path, tt.isDir)
+		source := ""
+		if d.Pattern != nil {
+			source = d.Pattern.Source
+		}
+		if d.Ignored != tt.ignored || source != tt.source {
+			t.Errorf("%s: got ignored %v by %q, want %v by %q (%s)", tt.path, d.Ignored, source, tt.ignored, tt.source, d)
+		}
+	}
+	if d := m.Explain("build/out.go", false); d.Dir != "build" {
+		t.Errorf("got %q, want the parent directory named", d)
+	}
+}
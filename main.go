@@ -1,56 +1,115 @@
 package main
 
 import (
-	"aaai/anthropic"
-	"aaai/diff"
-	"aaai/prompt"
+	"aaai/agent"
+	"aaai/config"
+	"aaai/mock"
+	"aaai/openai"
+	"aaai/provider"
+	"context"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/chzyer/readline"
+
+	_ "aaai/anthropic"
+	_ "aaai/ollama"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("./aaai [dir]")
-		return
+	providerFlag := flag.String("provider", "", "model provider: "+strings.Join(provider.Names(), ", "))
+	modelFlag := flag.String("model", "", "model name, defaults to the provider's default model")
+	maxTokensFlag := flag.Int("max-tokens", 0, "maximum tokens to generate per response")
+	thinkFlag := flag.Int("think", 0, "tokens the model may spend reasoning before it answers")
+	agentFlag := flag.Bool("agent", false, "let the model explore the repository with tools instead of sending every file")
+	recordFlag := flag.String("record", "", "save every streamed response to this directory")
+	replayFlag := flag.String("replay", "", "answer from transcripts in this directory instead of a provider")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "./aaai [flags] [dir]")
+		flag.PrintDefaults()
 	}
-	dir := os.Args[1]
+	flag.Parse()
 
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
-		fmt.Println("Please set ANTHROPIC_API_KEY environment variable")
+	if flag.NArg() < 1 {
+		flag.Usage()
 		return
 	}
-	apiKey = os.Getenv("DEEPSEEK")
-	if apiKey == "" {
-		fmt.Println("Please set DEEPSEEK environment variable")
+	dir := flag.Arg(0)
+
+	cfg, err := config.Load(dir)
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
-	apiKey = os.Getenv("GROQ")
-	if apiKey == "" {
-		fmt.Println("Please set GROQ environment variable")
+	if *providerFlag != "" && *providerFlag != cfg.Provider {
+		// A model from a config file belongs to the configured
+		// provider, not the one picked on the command line.
+		cfg.Provider = *providerFlag
+		cfg.Model = ""
+	}
+	if *modelFlag != "" {
+		cfg.Model = *modelFlag
+	}
+	if *maxTokensFlag != 0 {
+		cfg.MaxTokens = *maxTokensFlag
+	}
+	if *agentFlag {
+		cfg.Agent = true
+	}
+	if *thinkFlag != 0 {
+		cfg.ReasoningBudget = *thinkFlag
+	}
+
+	var client provider.Provider
+	if *replayFlag != "" {
+		client, err = mock.NewFromDir(*replayFlag)
+	} else {
+		client, err = newClient(cfg, *recordFlag)
+	}
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
-	apiKey = os.Getenv("ANTHROPIC_API_KEY")
 
-	client := anthropic.NewClient(apiKey)
-	//client := deepseek.NewClient(apiKey)
-	//client := groq.NewClient(apiKey)
+	sess := newSession(dir, client)
+	sess.read = cfg.Read
+	if cfg.ReasoningBudget > 0 {
+		if !client.Capabilities().Reasoning {
+			fmt.Printf("provider %s cannot be asked to reason\n", client.Name())
+			return
+		}
+		sess.conv.ReasoningBudget = cfg.ReasoningBudget
+	}
+	if cfg.Agent {
+		sess.agent, err = agent.New(client, dir)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 
 	rl, _ := readline.NewEx(&readline.Config{
 		Prompt:          "> ",
 		HistoryFile:     ".aaai.input.history",
 		InterruptPrompt: "^C",
 		EOFPrompt:       "quit",
+		AutoComplete:    completer{sess},
 	})
 
-	buffer := []string{}
+	sess.confirm = func(question string) bool {
+		rl.SetPrompt(question + " [y/N] ")
+		defer rl.SetPrompt("> ")
+		answer, err := rl.Readline()
+		return err == nil && strings.EqualFold(strings.TrimSpace(answer), "y")
+	}
 
+	buffer := []string{}
 	for {
-		fcs := prompt.AssembleFiles(dir)
 		fmt.Print("> ")
 
 		line, err := rl.Readline()
@@ -61,6 +120,13 @@ func main() {
 
 		input := strings.TrimSpace(line)
 
+		if strings.HasPrefix(input, "/") {
+			if err := sess.command(input); err != nil {
+				fmt.Println(err)
+			}
+			continue
+		}
+
 		if input == "." {
 			joined := strings.Join(buffer, "\\n")
 
@@ -71,44 +137,13 @@ func main() {
 				historyFile.Close()
 			}
 
-			// Process the command
-			joined = strings.Join(buffer, "\n")
-			p := prompt.MakePrompt(joined, fcs)
-			s, err := client.Complete(p)
-			fmt.Println(err)
-			fmt.Println("")
-			fmt.Println("")
-			fmt.Println("")
-			fmt.Println("")
-			fmt.Println(s)
-			m := prompt.ParseDiffs(s)
-			fmt.Println("===")
-			fmt.Println(m)
-			fmt.Println("===")
-
-			// Create tests directory if it doesn't exist
-			testsDir := "tests"
-			if err := os.MkdirAll(testsDir, 0755); err != nil {
-				fmt.Printf("Error creating tests directory: %v\n", err)
-				continue
-			}
-
-			for k, v := range m {
-				// Get original file content
-				origContent, origErr := os.ReadFile(filepath.Join(dir, k))
-
-				// Write original file to tests/file.orig
-				origPath := filepath.Join(testsDir, k+".orig")
-				if err := os.MkdirAll(filepath.Dir(origPath), 0755); err != nil {
-					fmt.Printf("Error creating directory for %s: %v\n", origPath, err)
-					continue
-				}
-				if origErr == nil {
-					os.WriteFile(origPath, origContent, 0644)
-				}
-				// Write diff to tests/file.diff
-				os.WriteFile(filepath.Join(testsDir, k+".diff"), []byte(v), 0644)
-				diff.ApplyPatch(dir+"/"+k, v)
+			// Process the command; Ctrl-C while the model is answering
+			// cancels just this request.
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			err = sess.submit(ctx, strings.Join(buffer, "\n"))
+			stop()
+			if err != nil {
+				fmt.Println(err)
 			}
 			buffer = []string{}
 		} else {
@@ -117,3 +152,86 @@ func main() {
 
 	}
 }
+
+// newClient creates the provider selected by cfg. When record is set every
+// response is also saved there as a transcript for --replay.
+func newClient(cfg *config.Config, record string) (provider.Provider, error) {
+	if err := registerProviders(cfg); err != nil {
+		return nil, err
+	}
+
+	name := cfg.Provider
+	if provider.Models(name) == nil {
+		return nil, fmt.Errorf("unknown provider %q (available: %v)", name, provider.Names())
+	}
+
+	apiKey, err := cfg.APIKey(name)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := provider.Options{
+		APIKey:    apiKey,
+		Model:     cfg.Model,
+		MaxTokens: cfg.MaxTokens,
+	}
+	if pc := cfg.Providers[name]; pc != nil {
+		opts.BaseURL = pc.BaseURL
+		opts.AuthHeader = pc.AuthHeader
+		opts.Headers = pc.Headers
+	}
+	opts.Retry = provider.DefaultRetryPolicy
+	if cfg.MaxAttempts > 0 {
+		opts.Retry.MaxAttempts = cfg.MaxAttempts
+	}
+	opts.Retry.OnRetry = func(err error, wait time.Duration) {
+		fmt.Printf("%v, retrying in %s\n", err, wait.Round(100*time.Millisecond))
+	}
+	if record != "" {
+		opts.HTTPClient = &http.Client{Transport: mock.NewRecorder(record)}
+	}
+	return provider.New(name, opts)
+}
+
+// registerProviders adds an OpenAI compatible provider for every entry
+// under providers: that doesn't name a built-in one, and the models listed
+// for built-in ones.
+func registerProviders(cfg *config.Config) error {
+	for name, pc := range cfg.Providers {
+		if provider.Models(name) != nil {
+			if err := provider.AddModels(name, configModels(pc, provider.Models(name))...); err != nil {
+				return err
+			}
+			continue
+		}
+		if pc.BaseURL == "" {
+			return fmt.Errorf("providers.%s: base_url is required", name)
+		}
+		if len(pc.Models) == 0 {
+			return fmt.Errorf("providers.%s: model is required", name)
+		}
+		openai.Register(name, pc.BaseURL, configModels(pc, nil)...)
+	}
+	return nil
+}
+
+// configModels returns the models listed in pc. Each starts from the
+// entry of the same name in known, or from small defaults, and takes the
+// limits pc sets.
+func configModels(pc *config.ProviderConfig, known []provider.ModelInfo) []provider.ModelInfo {
+	models := make([]provider.ModelInfo, len(pc.Models))
+	for i, name := range pc.Models {
+		info, ok := provider.FindModel(known, name)
+		if !ok {
+			info = provider.ModelInfo{Name: name, ContextWindow: 8192, MaxOutputTokens: 4096}
+		}
+		if pc.ContextWindow > 0 {
+			info.ContextWindow = pc.ContextWindow
+		}
+		if pc.MaxOutputTokens > 0 {
+			info.MaxOutputTokens = pc.MaxOutputTokens
+		}
+		models[i] = info
+	}
+	return models
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"aaai/config"
+	"aaai/mock"
+	"aaai/provider"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chdir moves into a scratch directory so the tests/ copies written by
+// apply don't land in the repository.
+func chdir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestSubmitAppliesReplayedEdit(t *testing.T) {
+	for _, transcript := range []string{"anthropic_edit.sse", "openai_edit.sse"} {
+		t.Run(transcript, func(t *testing.T) {
+			path, _ := filepath.Abs(filepath.Join("mock", "testdata", transcript))
+			client, err := mock.New(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chdir(t)
+
+			dir := t.TempDir()
+			hello := filepath.Join(dir, "hello.go")
+			os.WriteFile(hello, []byte("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"), 0644)
+
+			sess := newSession(dir, client)
+			if err := sess.submit(context.Background(), "print hello, world"); err != nil {
+				t.Fatal(err)
+			}
+
+			got, _ := os.ReadFile(hello)
+			if !strings.Contains(string(got), `fmt.Println("hello, world")`) {
+				t.Errorf("edit not applied:\n%s", got)
+			}
+			if len(sess.conv.Messages) != 2 {
+				t.Errorf("got %d messages in history, want 2", len(sess.conv.Messages))
+			}
+
+			sent := string(client.Replayer.Requests[0])
+			if !strings.Contains(sent, "hello.go") {
+				t.Errorf("file context not sent: %s", sent)
+			}
+		})
+	}
+}
+
+func TestSubmitRejectsIncompleteResponse(t *testing.T) {
+	path, _ := filepath.Abs(filepath.Join("mock", "testdata", "anthropic_overloaded.sse"))
+	client, err := mock.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chdir(t)
+
+	dir := t.TempDir()
+	hello := filepath.Join(dir, "hello.go")
+	orig := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"
+	os.WriteFile(hello, []byte(orig), 0644)
+
+	sess := newSession(dir, client)
+	if err := sess.submit(context.Background(), "print hello, world"); err == nil {
+		t.Fatal("expected error for overloaded stream")
+	}
+	if got, _ := os.ReadFile(hello); string(got) != orig {
+		t.Errorf("file changed by incomplete response:\n%s", got)
+	}
+	if len(sess.conv.Messages) != 0 {
+		t.Errorf("failed turn recorded in history")
+	}
+}
+
+func TestSubmitSendsConventions(t *testing.T) {
+	tests := []struct {
+		read []string
+		want string
+		not  string
+	}{
+		{nil, "CONVENTIONS.md (read-only)", "STYLE.md"},
+		{[]string{"STYLE.md"}, "STYLE.md (read-only)", "CONVENTIONS.md"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.read, ","), func(t *testing.T) {
+			path, _ := filepath.Abs(filepath.Join("mock", "testdata", "anthropic_edit.sse"))
+			client, err := mock.New(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chdir(t)
+
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "hello.go"), []byte("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"), 0644)
+			os.WriteFile(filepath.Join(dir, "CONVENTIONS.md"), []byte("Wrap errors with %w.\n"), 0644)
+			os.WriteFile(filepath.Join(dir, "STYLE.md"), []byte("Use log/slog.\n"), 0644)
+
+			sess := newSession(dir, client)
+			sess.read = tt.read
+			if err := sess.submit(context.Background(), "print hello, world"); err != nil {
+				t.Fatal(err)
+			}
+
+			sent := string(client.Replayer.Requests[0])
+			conv, file := strings.Index(sent, tt.want), strings.Index(sent, "hello.go")
+			if conv < 0 || file < conv {
+				t.Errorf("read %q: want %s before hello.go in\n%s", tt.read, tt.want, sent)
+			}
+			if strings.Contains(sent, tt.not) {
+				t.Errorf("read %q: %s sent too", tt.read, tt.not)
+			}
+		})
+	}
+}
+
+func TestSubmitSendsAttachmentsOnce(t *testing.T) {
+	path, _ := filepath.Abs(filepath.Join("mock", "testdata", "anthropic_edit.sse"))
+	client, err := mock.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chdir(t)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "hello.go"), []byte("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"), 0644)
+	png := filepath.Join(t.TempDir(), "ui.png")
+	os.WriteFile(png, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0644)
+
+	sess := newSession(dir, client)
+	if err := sess.attach(png); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.submit(context.Background(), "print hello, world"); err != nil {
+		t.Fatal(err)
+	}
+	if sent := string(client.Replayer.Requests[0]); !strings.Contains(sent, `"media_type":"image/png"`) {
+		t.Errorf("attachment not sent: %s", sent)
+	}
+	if sess.conv.HasAttachments() || len(sess.attachments) != 0 {
+		t.Error("attachment kept for later requests")
+	}
+}
+
+func TestConfigOverridesModelLimits(t *testing.T) {
+	saved := provider.Models("ollama")
+	t.Cleanup(func() { provider.AddModels("ollama", saved...) })
+
+	cfg := config.Default()
+	cfg.Provider = "ollama"
+	cfg.Model = "llama3.1:8b"
+	cfg.Providers["ollama"] = &config.ProviderConfig{Models: []string{"llama3.1:8b", "mistral:7b"}, ContextWindow: 8192}
+	client, err := newClient(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	models := provider.Models("ollama")
+	for name, want := range map[string]provider.ModelInfo{
+		"llama3.1:8b": {Name: "llama3.1:8b", ContextWindow: 8192, MaxOutputTokens: 8192},
+		"mistral:7b":  {Name: "mistral:7b", ContextWindow: 8192, MaxOutputTokens: 4096},
+	} {
+		if got, _ := provider.FindModel(models, name); got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+	if got := client.Model().ContextWindow; got != 8192 {
+		t.Errorf("client reports a %d token window, want 8192", got)
+	}
+}
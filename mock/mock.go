@@ -0,0 +1,254 @@
+package mock
+
+import (
+	"aaai/anthropic"
+	"aaai/ollama"
+	"aaai/openai"
+	"aaai/provider"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extension is the file extension of recorded transcripts.
+const Extension = ".sse"
+
+// Format is the wire format of a transcript.
+type Format string
+
+const (
+	FormatAnthropic Format = "anthropic"
+	FormatOpenAI    Format = "openai"
+	FormatOllama    Format = "ollama"
+)
+
+// Provider replays recorded transcripts through the real client for their
+// format, one transcript per request, so the streaming code paths are
+// exercised without a network.
+type Provider struct {
+	provider.Provider
+	Replayer *Replayer
+}
+
+// New returns a provider answering requests with files in order.
+func New(files ...string) (*Provider, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("mock: no transcripts")
+	}
+
+	format, err := DetectFormat(files[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files[1:] {
+		other, err := DetectFormat(f)
+		if err != nil {
+			return nil, err
+		}
+		if other != format {
+			return nil, fmt.Errorf("mock: %s is in %s format, %s is in %s format", files[0], format, f, other)
+		}
+	}
+
+	r := NewReplayer(files...)
+	httpClient := &http.Client{Transport: r}
+
+	var p provider.Provider
+	switch format {
+	case FormatAnthropic:
+		c := anthropic.NewClient("mock")
+		c.HTTPClient = httpClient
+		p = c
+	case FormatOpenAI:
+		c := openai.NewClient("mock", "http://mock", "mock")
+		c.HTTPClient = httpClient
+		p = c
+	case FormatOllama:
+		c := ollama.NewClient()
+		c.BaseURL = "http://mock"
+		c.HTTPClient = httpClient
+		p = c
+	}
+	return &Provider{Provider: p, Replayer: r}, nil
+}
+
+// NewFromDir replays every transcript in dir in name order.
+func NewFromDir(dir string) (*Provider, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+Extension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("mock: no %s files in %s", Extension, dir)
+	}
+	return New(files...)
+}
+
+func (p *Provider) Name() string {
+	return "mock"
+}
+
+// DetectFormat tells Anthropic event streams, which name their events,
+// from OpenAI data-only chunk streams and Ollama NDJSON.
+func DetectFormat(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("mock: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "event:"):
+			return FormatAnthropic, nil
+		case strings.HasPrefix(line, "{"):
+			return FormatOllama, nil
+		case strings.HasPrefix(line, "data:"):
+			if strings.Contains(line, `"type":`) {
+				return FormatAnthropic, nil
+			}
+			return FormatOpenAI, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("mock: %w", err)
+	}
+	return "", fmt.Errorf("mock: cannot tell the format of %s", path)
+}
+
+// Replayer is an http.RoundTripper answering each request with the next
+// transcript file. The bodies of the requests it received are kept for
+// assertions.
+type Replayer struct {
+	mu       sync.Mutex
+	files    []string
+	Requests [][]byte
+}
+
+func NewReplayer(files ...string) *Replayer {
+	return &Replayer{files: files}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	n := len(r.Requests)
+	r.Requests = append(r.Requests, body)
+	r.mu.Unlock()
+
+	if n >= len(r.files) {
+		return nil, fmt.Errorf("mock: no transcript left for request %d", n+1)
+	}
+	data, err := os.ReadFile(r.files[n])
+	if err != nil {
+		return nil, fmt.Errorf("mock: %w", err)
+	}
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"text/event-stream"}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+		Request:    req,
+	}, nil
+}
+
+// Recorder is an http.RoundTripper that saves every successful response
+// body it passes through to Dir as a numbered transcript for later replay.
+// Error responses, such as rate limits that the client retries, are not
+// recorded, so replay sees just the streams the client used.
+type Recorder struct {
+	Dir       string
+	Transport http.RoundTripper
+
+	mu sync.Mutex
+	n  int
+}
+
+func NewRecorder(dir string) *Recorder {
+	return &Recorder{Dir: dir, Transport: http.DefaultTransport}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, nil
+	}
+
+	path, err := r.nextPath()
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("mock: %w", err)
+	}
+
+	resp.Body = &teeBody{ReadCloser: resp.Body, file: f}
+	return resp, nil
+}
+
+func (r *Recorder) nextPath() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(r.Dir, 0755); err != nil {
+		return "", fmt.Errorf("mock: %w", err)
+	}
+	if r.n == 0 {
+		existing, _ := filepath.Glob(filepath.Join(r.Dir, "*"+Extension))
+		r.n = len(existing)
+	}
+	r.n++
+	return filepath.Join(r.Dir, fmt.Sprintf("%03d%s", r.n, Extension)), nil
+}
+
+type teeBody struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		if _, werr := t.file.Write(p[:n]); werr != nil {
+			return n, fmt.Errorf("mock: %w", werr)
+		}
+	}
+	return n, err
+}
+
+func (t *teeBody) Close() error {
+	t.file.Close()
+	return t.ReadCloser.Close()
+}
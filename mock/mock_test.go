@@ -0,0 +1,176 @@
+package mock
+
+import (
+	"aaai/prompt"
+	"aaai/provider"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const editText = "Here is the change:\n\n```diff\n--- hello.go\n+++ hello.go\n" +
+	"@@ -4,3 +4,3 @@\n func main() {\n-\tfmt.Println(\"hello\")\n" +
+	"+\tfmt.Println(\"hello, world\")\n }\n```\n"
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		file   string
+		format Format
+		usage  prompt.Usage
+	}{
+		{"testdata/anthropic_edit.sse", FormatAnthropic, prompt.Usage{InputTokens: 412, OutputTokens: 58}},
+		{"testdata/openai_edit.sse", FormatOpenAI, prompt.Usage{InputTokens: 270, OutputTokens: 61, CacheReadTokens: 128}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			format, err := DetectFormat(tt.file)
+			if err != nil || format != tt.format {
+				t.Fatalf("DetectFormat = %q, %v, want %q", format, err, tt.format)
+			}
+
+			p, err := New(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conv := prompt.NewConversation().With("say hello, world")
+			s, err := p.Stream(context.Background(), conv, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Text != editText || !s.Finished() {
+				t.Errorf("got %q (%s), want %q", s.Text, s.StopReason, editText)
+			}
+			if s.Usage != tt.usage {
+				t.Errorf("got usage %+v, want %+v", s.Usage, tt.usage)
+			}
+			if len(p.Replayer.Requests) != 1 || !strings.Contains(string(p.Replayer.Requests[0]), "say hello, world") {
+				t.Errorf("request not captured: %q", p.Replayer.Requests)
+			}
+
+			if _, err := p.Stream(context.Background(), conv, nil); err == nil {
+				t.Error("expected error once transcripts run out")
+			}
+		})
+	}
+}
+
+func TestReplayMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.sse")
+	os.WriteFile(path, []byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\n\n"), 0644)
+
+	p, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Stream(context.Background(), prompt.NewConversation().With("hi"), nil); err == nil {
+		t.Error("expected error for malformed event")
+	}
+}
+
+func TestRecord(t *testing.T) {
+	transcript, _ := os.ReadFile("testdata/openai_edit.sse")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(transcript)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := &http.Client{Transport: NewRecorder(dir)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(server.URL, "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 64)
+		for {
+			if _, err := resp.Body.Read(buf); err != nil {
+				break
+			}
+		}
+		resp.Body.Close()
+	}
+
+	for i := 1; i <= 2; i++ {
+		got, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%03d%s", i, Extension)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(transcript) {
+			t.Errorf("transcript %d differs from the response", i)
+		}
+	}
+
+	p, err := NewFromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := p.Stream(context.Background(), prompt.NewConversation().With("hi"), nil)
+	if err != nil || s.Text != editText {
+		t.Errorf("replaying recording got %+v, %v", s, err)
+	}
+}
+
+func TestRecordSkipsErrors(t *testing.T) {
+	transcript, _ := os.ReadFile("testdata/anthropic_edit.sse")
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`)
+			return
+		}
+		w.Write(transcript)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := &http.Client{Transport: NewRecorder(dir)}
+	policy := provider.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	resp, err := provider.Do(context.Background(), client, policy, func() (*http.Request, error) {
+		return http.NewRequest("POST", server.URL, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+Extension))
+	if calls != 2 || len(files) != 1 {
+		t.Fatalf("got %d calls and transcripts %q, want 2 calls and one transcript", calls, files)
+	}
+	p, err := NewFromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := p.Stream(context.Background(), prompt.NewConversation().With("hi"), nil)
+	if err != nil || s.Text != editText {
+		t.Errorf("replaying recording got %+v, %v", s, err)
+	}
+}
+
+func TestReplayErrorEvent(t *testing.T) {
+	p, err := New("testdata/anthropic_overloaded.sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := p.Stream(context.Background(), prompt.NewConversation().With("hi"), nil)
+	var overloaded *provider.OverloadedError
+	if !errors.As(err, &overloaded) {
+		t.Fatalf("got error %v, want OverloadedError", err)
+	}
+	if s == nil || !strings.Contains(s.Text, "+++ hello.go") || s.Finished() {
+		t.Errorf("partial response not returned: %+v", s)
+	}
+}
@@ -0,0 +1,243 @@
+package ollama
+
+import (
+	"aaai/prompt"
+	"aaai/provider"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	DefaultModel   = "qwen2.5-coder:7b"
+	DefaultBaseURL = "http://localhost:11434"
+)
+
+// Models lists commonly pulled coding models. Others can be added under
+// providers: ollama: models: in the config file.
+var Models = []provider.ModelInfo{
+	{Name: "qwen2.5-coder:7b", ContextWindow: 32768, MaxOutputTokens: 8192},
+	{Name: "qwen2.5-coder:32b", ContextWindow: 32768, MaxOutputTokens: 8192},
+	{Name: "llama3.1:8b", ContextWindow: 131072, MaxOutputTokens: 8192},
+	{Name: "deepseek-coder-v2:16b", ContextWindow: 131072, MaxOutputTokens: 8192},
+	{Name: "codellama:13b", ContextWindow: 16384, MaxOutputTokens: 4096},
+}
+
+// Client talks to a local Ollama server through /api/chat.
+type Client struct {
+	BaseURL    string
+	ModelName  string
+	MaxTokens  int
+	Retry      provider.RetryPolicy
+	HTTPClient *http.Client
+}
+
+type ChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+	Options  *Options  `json:"options,omitempty"`
+
+	// Think asks a thinking model to send its reasoning apart from the
+	// answer. Ollama has no budget for it.
+	Think bool `json:"think,omitempty"`
+}
+
+type Message struct {
+	Role     string `json:"role"`
+	Content  string `json:"content"`
+	Thinking string `json:"thinking,omitempty"`
+}
+
+type Options struct {
+	NumPredict int `json:"num_predict,omitempty"`
+
+	// NumCtx sets the context window. Ollama otherwise loads the model
+	// with a small default and silently drops the start of longer
+	// prompts.
+	NumCtx int `json:"num_ctx,omitempty"`
+}
+
+// ChatResponse is one line of the NDJSON stream returned by /api/chat.
+type ChatResponse struct {
+	Model      string  `json:"model"`
+	Message    Message `json:"message"`
+	Done       bool    `json:"done"`
+	DoneReason string  `json:"done_reason,omitempty"`
+	Error      string  `json:"error,omitempty"`
+
+	// Token counts, sent with the final line.
+	PromptEvalCount int `json:"prompt_eval_count,omitempty"`
+	EvalCount       int `json:"eval_count,omitempty"`
+}
+
+// doneReasons maps Ollama done reasons to provider stop reasons.
+var doneReasons = map[string]string{
+	"":       "end_turn",
+	"stop":   "end_turn",
+	"length": "max_tokens",
+}
+
+// NewClient returns a client for the server in OLLAMA_HOST, or the
+// default local address.
+func NewClient() *Client {
+	baseURL := DefaultBaseURL
+	if host := os.Getenv("OLLAMA_HOST"); host != "" {
+		baseURL = host
+		if !strings.Contains(baseURL, "://") {
+			baseURL = "http://" + baseURL
+		}
+	}
+	return &Client{
+		BaseURL:    baseURL,
+		ModelName:  DefaultModel,
+		MaxTokens:  8192,
+		Retry:      provider.DefaultRetryPolicy,
+		HTTPClient: &http.Client{},
+	}
+}
+
+func init() {
+	provider.Register("ollama", func(opts provider.Options) provider.Provider {
+		c := NewClient()
+		if opts.BaseURL != "" {
+			c.BaseURL = opts.BaseURL
+		}
+		c.ModelName = opts.Model
+		c.MaxTokens = opts.MaxTokens
+		if opts.Retry.MaxAttempts > 0 {
+			c.Retry = opts.Retry
+		}
+		if opts.HTTPClient != nil {
+			c.HTTPClient = opts.HTTPClient
+		}
+		return c
+	}, Models...)
+}
+
+func (c *Client) Name() string {
+	return "ollama"
+}
+
+func (c *Client) Model() provider.ModelInfo {
+	if info, ok := provider.FindModel(provider.Models("ollama"), c.ModelName); ok {
+		return info
+	}
+	return provider.ModelInfo{Name: c.ModelName, MaxOutputTokens: c.MaxTokens}
+}
+
+func (c *Client) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Streaming:    true,
+		SystemPrompt: true,
+		Reasoning:    true,
+	}
+}
+
+func messages(conv *prompt.Conversation) []Message {
+	msgs := make([]Message, 0, len(conv.Messages)+1)
+	if system := conv.SystemText(); system != "" {
+		msgs = append(msgs, Message{Role: "system", Content: system})
+	}
+	for _, m := range conv.Messages {
+		msgs = append(msgs, Message{Role: m.Role, Content: m.Content})
+	}
+	return msgs
+}
+
+func (c *Client) Complete(ctx context.Context, conv *prompt.Conversation) (*provider.Response, error) {
+	return c.Stream(ctx, conv, nil)
+}
+
+func (c *Client) Stream(ctx context.Context, conv *prompt.Conversation, h prompt.Handler) (*provider.Response, error) {
+	if len(conv.Tools) > 0 {
+		return nil, fmt.Errorf("%s does not support tools", c.Name())
+	}
+	if conv.HasAttachments() {
+		return nil, fmt.Errorf("%s does not support attachments", c.Name())
+	}
+
+	req := ChatRequest{
+		Model:    c.ModelName,
+		Messages: messages(conv),
+		Stream:   true,
+		Think:    conv.ReasoningBudget > 0,
+	}
+	opts := Options{NumCtx: c.Model().ContextWindow}
+	if c.MaxTokens > 0 {
+		opts.NumPredict = c.MaxTokens
+	}
+	if opts != (Options{}) {
+		req.Options = &opts
+	}
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	endpoint := strings.TrimSuffix(c.BaseURL, "/") + "/api/chat"
+	response, err := provider.Do(ctx, c.HTTPClient, c.Retry, func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, err
+		}
+
+		request.Header.Set("Content-Type", "application/json")
+		return request, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	reader := bufio.NewReader(response.Body)
+	parser := prompt.NewStreamParser(h)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			resp, _ := provider.Result(parser)
+			return resp, fmt.Errorf("error reading stream: %w", err)
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var chunk ChatResponse
+			if jerr := json.Unmarshal(line, &chunk); jerr != nil {
+				resp, _ := provider.Result(parser)
+				return resp, fmt.Errorf("error decoding stream: %w", jerr)
+			}
+			if chunk.Error != "" {
+				resp, _ := provider.Result(parser)
+				return resp, provider.EventError("", chunk.Error)
+			}
+			parser.ProcessReasoning(chunk.Message.Thinking)
+			if chunk.Message.Content != "" {
+				parser.ProcessLineAsString(chunk.Message.Content)
+			}
+			if chunk.Done {
+				reason, ok := doneReasons[chunk.DoneReason]
+				if !ok {
+					reason = chunk.DoneReason
+				}
+				parser.SetUsage(prompt.Usage{
+					InputTokens:  chunk.PromptEvalCount,
+					OutputTokens: chunk.EvalCount,
+				})
+				parser.Finish(reason)
+				break
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+	return provider.Result(parser)
+}
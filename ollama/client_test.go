@@ -0,0 +1,120 @@
+package ollama
+
+import (
+	"aaai/prompt"
+	"aaai/provider"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c := NewClient()
+	c.BaseURL = server.URL
+	return c
+}
+
+func TestStream(t *testing.T) {
+	var got ChatRequest
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, s := range []string{"--- a/main.go\n", "+++ b/main.go\n"} {
+			fmt.Fprintf(w, "{\"model\":\"qwen2.5-coder:7b\",\"message\":{\"role\":\"assistant\",\"content\":%q},\"done\":false}\n", s)
+		}
+		fmt.Fprint(w, "{\"model\":\"qwen2.5-coder:7b\",\"message\":{\"role\":\"assistant\",\"content\":\"\"},\"done\":true,\"done_reason\":\"stop\"}\n")
+	})
+	c.MaxTokens = 512
+
+	conv := prompt.NewConversation()
+	conv.System = "edit code"
+	conv.AddUser("first")
+	conv.AddAssistant("ok")
+	conv.AddUser("second")
+
+	var deltas []string
+	s, err := c.Stream(context.Background(), conv, prompt.HandlerFunc(func(e prompt.Event) {
+		if e.Type == prompt.EventText {
+			deltas = append(deltas, e.Text)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Text != "--- a/main.go\n+++ b/main.go\n" || s.StopReason != provider.StopEndTurn {
+		t.Errorf("got %+v", s)
+	}
+	if len(deltas) != 2 {
+		t.Errorf("got %d deltas, want 2", len(deltas))
+	}
+
+	if !got.Stream || got.Model != DefaultModel {
+		t.Errorf("unexpected request %+v", got)
+	}
+	if got.Options == nil || got.Options.NumPredict != 512 || got.Options.NumCtx != 32768 {
+		t.Errorf("num_predict and num_ctx not sent: %+v", got.Options)
+	}
+	roles := []string{}
+	for _, m := range got.Messages {
+		roles = append(roles, m.Role)
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" {
+		t.Errorf("got roles %v", roles)
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "Server error",
+			body: "{\"error\":\"model 'nope' not found\"}\n",
+			want: "model 'nope' not found",
+		},
+		{
+			name: "Malformed line",
+			body: "{\"message\":{\"content\":\"partial\"}}\nnot json\n",
+			want: "error decoding stream",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tt.body)
+			})
+			_, err := c.Stream(context.Background(), prompt.NewConversation().With("hi"), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamWithoutDone(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{\"message\":{\"content\":\"no trailing newline\"}}")
+	})
+	s, err := c.Stream(context.Background(), prompt.NewConversation().With("hi"), nil)
+	if err != provider.ErrIncomplete {
+		t.Fatalf("got error %v, want ErrIncomplete", err)
+	}
+	if s.Text != "no trailing newline" {
+		t.Errorf("got %q", s.Text)
+	}
+}
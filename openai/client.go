@@ -0,0 +1,263 @@
+package openai
+
+import (
+	"aaai/prompt"
+	"aaai/provider"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Preset describes an OpenAI compatible service registered by default.
+type Preset struct {
+	Name    string
+	BaseURL string
+	Models  []provider.ModelInfo
+}
+
+var Presets = []Preset{
+	{
+		Name:    "deepseek",
+		BaseURL: "https://api.deepseek.com/v1",
+		Models: []provider.ModelInfo{
+			{Name: "deepseek-chat", ContextWindow: 64000, MaxOutputTokens: 8192},
+			{Name: "deepseek-reasoner", ContextWindow: 64000, MaxOutputTokens: 8192},
+		},
+	},
+	{
+		Name:    "groq",
+		BaseURL: "https://api.groq.com/openai/v1",
+		Models: []provider.ModelInfo{
+			{Name: "deepseek-r1-distill-llama-70b", ContextWindow: 128000, MaxOutputTokens: 8192},
+			{Name: "llama-3.3-70b-versatile", ContextWindow: 128000, MaxOutputTokens: 32768},
+			{Name: "llama-3.1-8b-instant", ContextWindow: 128000, MaxOutputTokens: 8192},
+		},
+	},
+}
+
+// Client talks to any server implementing the OpenAI chat completions
+// API.
+type Client struct {
+	APIKey  string
+	BaseURL string
+
+	// AuthHeader is the header carrying APIKey. Authorization sends it
+	// as a bearer token, any other header sends the bare key and "none"
+	// sends nothing.
+	AuthHeader string
+	Headers    map[string]string
+
+	ModelName  string
+	MaxTokens  int
+	Retry      provider.RetryPolicy
+	HTTPClient *http.Client
+
+	name string
+}
+
+type CompletionRequest struct {
+	Model         string         `json:"model"`
+	Messages      []Message      `json:"messages"`
+	MaxTokens     int            `json:"max_tokens,omitempty"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type CompletionResponse struct {
+	Choices []Choice       `json:"choices"`
+	Error   *ErrorResponse `json:"error,omitempty"`
+}
+
+type Choice struct {
+	Message Message `json:"message"`
+}
+
+type ErrorResponse struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+func NewClient(apiKey, baseURL, model string) *Client {
+	return &Client{
+		APIKey:     apiKey,
+		BaseURL:    baseURL,
+		AuthHeader: "Authorization",
+		ModelName:  model,
+		MaxTokens:  8192,
+		Retry:      provider.DefaultRetryPolicy,
+		HTTPClient: &http.Client{},
+		name:       "openai",
+	}
+}
+
+func init() {
+	for _, p := range Presets {
+		Register(p.Name, p.BaseURL, p.Models...)
+	}
+}
+
+// Register adds an OpenAI compatible provider under name. Options.BaseURL
+// overrides baseURL when set.
+func Register(name, baseURL string, models ...provider.ModelInfo) {
+	provider.Register(name, func(opts provider.Options) provider.Provider {
+		c := NewClient(opts.APIKey, baseURL, opts.Model)
+		if opts.BaseURL != "" {
+			c.BaseURL = opts.BaseURL
+		}
+		if opts.AuthHeader != "" {
+			c.AuthHeader = opts.AuthHeader
+		}
+		c.Headers = opts.Headers
+		c.MaxTokens = opts.MaxTokens
+		if opts.Retry.MaxAttempts > 0 {
+			c.Retry = opts.Retry
+		}
+		if opts.HTTPClient != nil {
+			c.HTTPClient = opts.HTTPClient
+		}
+		c.name = name
+		return c
+	}, models...)
+}
+
+func (c *Client) Name() string {
+	return c.name
+}
+
+func (c *Client) Model() provider.ModelInfo {
+	if info, ok := provider.FindModel(provider.Models(c.name), c.ModelName); ok {
+		return info
+	}
+	return provider.ModelInfo{Name: c.ModelName, MaxOutputTokens: c.MaxTokens}
+}
+
+func (c *Client) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Streaming:    true,
+		SystemPrompt: true,
+	}
+}
+
+func messages(conv *prompt.Conversation) []Message {
+	msgs := make([]Message, 0, len(conv.Messages)+1)
+	if system := conv.SystemText(); system != "" {
+		msgs = append(msgs, Message{Role: "system", Content: system})
+	}
+	for _, m := range conv.Messages {
+		msgs = append(msgs, Message{Role: m.Role, Content: m.Content})
+	}
+	return msgs
+}
+
+func (c *Client) Complete(ctx context.Context, conv *prompt.Conversation) (*provider.Response, error) {
+	return c.Stream(ctx, conv, nil)
+}
+
+func (c *Client) Stream(ctx context.Context, conv *prompt.Conversation, h prompt.Handler) (*provider.Response, error) {
+	if len(conv.Tools) > 0 {
+		return nil, fmt.Errorf("%s does not support tools", c.Name())
+	}
+	if conv.HasAttachments() {
+		return nil, fmt.Errorf("%s does not support attachments", c.Name())
+	}
+
+	req := CompletionRequest{
+		Model:         c.ModelName,
+		Stream:        true,
+		StreamOptions: &StreamOptions{IncludeUsage: true},
+		Messages:      messages(conv),
+		MaxTokens:     c.MaxTokens,
+	}
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	endpoint := strings.TrimSuffix(c.BaseURL, "/") + "/chat/completions"
+	response, err := provider.Do(ctx, c.HTTPClient, c.Retry, func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, err
+		}
+
+		request.Header.Set("Content-Type", "application/json")
+		switch c.AuthHeader {
+		case "none", "":
+		case "Authorization":
+			request.Header.Set("Authorization", "Bearer "+c.APIKey)
+		default:
+			request.Header.Set(c.AuthHeader, c.APIKey)
+		}
+		for k, v := range c.Headers {
+			request.Header.Set(k, v)
+		}
+		return request, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	reader := bufio.NewReader(response.Body)
+	parser := prompt.NewStreamParser(h)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			resp, _ := provider.Result(parser)
+			return resp, fmt.Errorf("error reading stream: %w", err)
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+
+		if !bytes.HasPrefix(line, []byte("data: ")) {
+			continue
+		}
+
+		data := bytes.TrimPrefix(line, []byte("data: "))
+
+		if string(data) == "[DONE]\n" {
+			break
+		}
+
+		chunk, err := parseChunk(data)
+		if err != nil {
+			resp, _ := provider.Result(parser)
+			return resp, err
+		}
+		if chunk.Error != nil {
+			resp, _ := provider.Result(parser)
+			return resp, provider.EventError(chunk.Error.Type, chunk.Error.Message)
+		}
+		parser.ProcessReasoning(chunk.reasoning())
+		if s := chunk.content(); s != "" {
+			parser.ProcessLineAsString(s)
+		}
+		if chunk.Usage != nil {
+			parser.SetUsage(chunk.Usage.usage())
+		}
+		if reason := chunk.stopReason(); reason != "" {
+			parser.Finish(reason)
+		}
+	}
+	return provider.Result(parser)
+}
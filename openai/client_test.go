@@ -0,0 +1,122 @@
+package openai
+
+import (
+	"aaai/prompt"
+	"aaai/provider"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	var got CompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if h := r.Header.Get("api-key"); h != "secret" {
+			t.Errorf("api-key header = %q", h)
+		}
+		if h := r.Header.Get("X-Team"); h != "editors" {
+			t.Errorf("X-Team header = %q", h)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+
+		for _, s := range []string{"Hello", ", ", "world"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", s)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"length\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	c := NewClient("secret", server.URL+"/v1/", "local-model")
+	c.AuthHeader = "api-key"
+	c.Headers = map[string]string{"X-Team": "editors"}
+
+	conv := prompt.NewConversation()
+	conv.System = "be brief"
+	conv.AddUser("hi")
+
+	var deltas []string
+	s, err := c.Stream(context.Background(), conv, prompt.HandlerFunc(func(e prompt.Event) {
+		if e.Type == prompt.EventText {
+			deltas = append(deltas, e.Text)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Text != "Hello, world" {
+		t.Errorf("got %q", s.Text)
+	}
+	if s.StopReason != provider.StopMaxTokens || s.Finished() {
+		t.Errorf("length finish reason not reported: %q", s.StopReason)
+	}
+	if len(deltas) != 3 {
+		t.Errorf("got %d deltas, want 3", len(deltas))
+	}
+
+	if got.Model != "local-model" || len(got.Messages) != 2 {
+		t.Fatalf("unexpected request %+v", got)
+	}
+	if got.Messages[0].Role != "system" || got.Messages[0].Content != "be brief" {
+		t.Errorf("system prompt not sent first: %+v", got.Messages[0])
+	}
+}
+
+func TestStreamReasoning(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, d := range []string{
+			`{"reasoning_content":"Think"}`,
+			`{"reasoning_content":"ing."}`,
+			`{"content":"Answer"}`,
+		} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":%s}]}\n\n", d)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+	}))
+	defer server.Close()
+
+	c := NewClient("key", server.URL, "deepseek-reasoner")
+	conv := prompt.NewConversation()
+	conv.AddUser("hi")
+
+	var thinking string
+	resp, err := c.Stream(context.Background(), conv, prompt.HandlerFunc(func(e prompt.Event) {
+		if e.Type == prompt.EventThinking {
+			thinking += e.Text
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "Answer" || resp.Reasoning != "Thinking." || thinking != "Thinking." {
+		t.Errorf("got text %q, reasoning %q, thinking events %q", resp.Text, resp.Reasoning, thinking)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"partial\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewClient("key", server.URL, "m")
+	_, err := c.Stream(ctx, prompt.NewConversation().With("hi"), prompt.HandlerFunc(func(prompt.Event) { cancel() }))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
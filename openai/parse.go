@@ -0,0 +1,106 @@
+package openai
+
+import (
+	"aaai/prompt"
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// ChatCompletionChunk represents the JSON data
+type ChatCompletionChunk struct {
+	ID                string         `json:"id"`
+	Object            string         `json:"object"`
+	Created           int64          `json:"created"` // Use int64 for Unix timestamp
+	Model             string         `json:"model"`
+	SystemFingerprint string         `json:"system_fingerprint"`
+	Choices           []ParseChoice  `json:"choices"`
+	Usage             *ChunkUsage    `json:"usage,omitempty"`
+	Error             *ErrorResponse `json:"error,omitempty"`
+}
+
+// ChunkUsage is sent in the last chunk when stream_options.include_usage
+// is set.
+type ChunkUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details,omitempty"`
+
+	// DeepSeek reports cache hits in its own field.
+	PromptCacheHitTokens int `json:"prompt_cache_hit_tokens"`
+}
+
+// usage converts the counts so cached prompt tokens are reported apart
+// from the rest of the input, as Anthropic does.
+func (u *ChunkUsage) usage() prompt.Usage {
+	cached := u.PromptCacheHitTokens
+	if u.PromptTokensDetails != nil && u.PromptTokensDetails.CachedTokens > 0 {
+		cached = u.PromptTokensDetails.CachedTokens
+	}
+	return prompt.Usage{
+		InputTokens:     u.PromptTokens - cached,
+		OutputTokens:    u.CompletionTokens,
+		CacheReadTokens: cached,
+	}
+}
+
+type ParseChoice struct {
+	Index        int             `json:"index"`
+	Delta        Delta           `json:"delta"`
+	LogProbs     json.RawMessage `json:"logprobs"`      // Use json.RawMessage for null or not-present values
+	FinishReason *string         `json:"finish_reason"` // null until the last chunk
+}
+
+type Delta struct {
+	Content string `json:"content"`
+
+	// ReasoningContent is DeepSeek's field for the reasoner's thinking,
+	// Reasoning the one Groq uses with reasoning_format "parsed".
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	Reasoning        string `json:"reasoning,omitempty"`
+}
+
+// finishReasons maps OpenAI finish reasons to the Anthropic style stop
+// reasons used by provider.Response.
+var finishReasons = map[string]string{
+	"stop":       "end_turn",
+	"length":     "max_tokens",
+	"tool_calls": "tool_use",
+}
+
+func parseChunk(data []byte) (ChatCompletionChunk, error) {
+	var chunk ChatCompletionChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return chunk, fmt.Errorf("error decoding stream chunk %q: %w", bytes.TrimSpace(data), err)
+	}
+	return chunk, nil
+}
+
+// stopReason returns the normalized finish reason of the chunk, empty
+// while the model is still generating.
+func (c ChatCompletionChunk) stopReason() string {
+	if len(c.Choices) == 0 || c.Choices[0].FinishReason == nil {
+		return ""
+	}
+	reason := *c.Choices[0].FinishReason
+	if mapped, ok := finishReasons[reason]; ok {
+		return mapped
+	}
+	return reason
+}
+
+func (c ChatCompletionChunk) content() string {
+	if len(c.Choices) == 0 {
+		return ""
+	}
+	return c.Choices[0].Delta.Content
+}
+
+func (c ChatCompletionChunk) reasoning() string {
+	if len(c.Choices) == 0 {
+		return ""
+	}
+	return c.Choices[0].Delta.ReasoningContent + c.Choices[0].Delta.Reasoning
+}
@@ -0,0 +1,83 @@
+package prompt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Size limits of attachments once base64 encoded, as the Anthropic API
+// checks them. MaxRequestSize bounds a whole request, so a PDF is held
+// under it with room left for the files and conversation.
+const (
+	MaxImageSize   = 5 << 20
+	MaxRequestSize = 32 << 20
+	MaxPDFSize     = MaxRequestSize - 4<<20
+)
+
+// attachmentTypes maps the extensions of supported attachments to their
+// media types.
+var attachmentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// Attachment is a PDF or image sent along with a user message.
+type Attachment struct {
+	Filename  string
+	MediaType string
+	Data      []byte
+}
+
+// IsImage reports whether the attachment is an image rather than a
+// document.
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.MediaType, "image/")
+}
+
+// LoadAttachment reads a PDF or image, detecting its media type from the
+// content and falling back to the extension, and checks it against the
+// size limits.
+func LoadAttachment(path string) (Attachment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	mediaType := http.DetectContentType(data)
+	if _, ok := limit(mediaType); !ok {
+		mediaType = attachmentTypes[strings.ToLower(filepath.Ext(path))]
+	}
+	max, ok := limit(mediaType)
+	if !ok {
+		return Attachment{}, fmt.Errorf("%s: only PDF, PNG, JPEG, GIF and WebP files can be attached", path)
+	}
+	a := Attachment{Filename: path, MediaType: mediaType, Data: data}
+	if a.EncodedSize() > max {
+		return Attachment{}, fmt.Errorf("%s: %d bytes once encoded is over the %d MB limit for %s", path, a.EncodedSize(), max>>20, mediaType)
+	}
+	return a, nil
+}
+
+// EncodedSize is the size of the attachment's data in base64, as it is
+// sent.
+func (a Attachment) EncodedSize() int {
+	return base64.StdEncoding.EncodedLen(len(a.Data))
+}
+
+func limit(mediaType string) (int, bool) {
+	switch mediaType {
+	case "application/pdf":
+		return MaxPDFSize, true
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return MaxImageSize, true
+	}
+	return 0, false
+}
@@ -0,0 +1,48 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadAttachment(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, data, 0644)
+		return path
+	}
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	tests := []struct {
+		path      string
+		mediaType string
+		err       string
+	}{
+		{write("shot.png", png), "image/png", ""},
+		{write("misnamed.jpg", png), "image/png", ""},
+		{write("spec.pdf", []byte("%PDF-1.7\n")), "application/pdf", ""},
+		{write("photo.webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")), "image/webp", ""},
+		{write("notes.txt", []byte("hello")), "", "only PDF"},
+		{write("huge.png", append(png, make([]byte, MaxImageSize*4/5)...)), "", "over the 5 MB limit"},
+		{filepath.Join(dir, "missing.pdf"), "", "no such file"},
+	}
+	for _, tt := range tests {
+		a, err := LoadAttachment(tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if a.MediaType != tt.mediaType {
+			t.Errorf("%s: got media type %s, want %s", tt.path, a.MediaType, tt.mediaType)
+		}
+	}
+}
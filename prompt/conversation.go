@@ -0,0 +1,100 @@
+package prompt
+
+import "strings"
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Conversation accumulates the user and assistant turns of a session so
+// that every request carries the earlier exchanges.
+type Conversation struct {
+	System   string
+	Messages []Message
+
+	// Context holds the file blocks sent after System and before the
+	// messages. The first StableContext of them are unchanged since the
+	// previous request, so a provider can cache them as a prefix.
+	Context       []string
+	StableContext int
+
+	// Tools are the functions the model may call while answering.
+	Tools []Tool
+
+	// ReasoningBudget is the number of tokens the model may spend
+	// reasoning before it answers; zero leaves reasoning off where the
+	// provider lets it be turned off.
+	ReasoningBudget int
+}
+
+func NewConversation() *Conversation {
+	return &Conversation{}
+}
+
+func (c *Conversation) AddUser(content string, attachments ...Attachment) {
+	c.Messages = append(c.Messages, Message{Role: RoleUser, Content: content, Attachments: attachments})
+}
+
+func (c *Conversation) AddAssistant(content string) {
+	c.Messages = append(c.Messages, Message{Role: RoleAssistant, Content: content})
+}
+
+// AddToolCalls records an assistant turn that called tools, with any text
+// and reasoning it produced before doing so.
+func (c *Conversation) AddToolCalls(content string, calls []ToolCall, thinking []ThinkingBlock) {
+	c.Messages = append(c.Messages, Message{
+		Role:      RoleAssistant,
+		Content:   content,
+		ToolCalls: calls,
+		Thinking:  thinking,
+	})
+}
+
+// AddToolResults sends the results of the previous turn's tool calls.
+func (c *Conversation) AddToolResults(results []ToolResult) {
+	c.Messages = append(c.Messages, Message{Role: RoleUser, ToolResults: results})
+}
+
+// Clone returns a copy of the conversation that can be extended without
+// changing c.
+func (c *Conversation) Clone() *Conversation {
+	next := &Conversation{
+		System:          c.System,
+		Context:         c.Context,
+		StableContext:   c.StableContext,
+		Tools:           c.Tools,
+		ReasoningBudget: c.ReasoningBudget,
+		Messages:        make([]Message, len(c.Messages), len(c.Messages)+1),
+	}
+	copy(next.Messages, c.Messages)
+	return next
+}
+
+// SystemText returns the system prompt followed by the context, for APIs
+// that take both in one system message.
+func (c *Conversation) SystemText() string {
+	if len(c.Context) == 0 {
+		return c.System
+	}
+	return c.System + "\n\n" + strings.Join(c.Context, "")
+}
+
+// With returns a copy of the conversation with one more user message,
+// leaving c unchanged. It is used to send a turn that should only be
+// recorded once the model has answered.
+func (c *Conversation) With(content string, attachments ...Attachment) *Conversation {
+	next := c.Clone()
+	next.AddUser(content, attachments...)
+	return next
+}
+
+// HasAttachments reports whether any message carries attachments.
+func (c *Conversation) HasAttachments() bool {
+	for _, m := range c.Messages {
+		if len(m.Attachments) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package prompt
+
+import (
+	"fmt"
+	"io"
+)
+
+type EventType int
+
+const (
+	// EventText carries a delta of the answer in Text.
+	EventText EventType = iota
+	// EventThinking carries a delta of the model's reasoning in Text.
+	EventThinking
+	// EventToolUse carries a delta of a tool call's JSON input in Text.
+	// The first event of a call has ToolID and ToolName set.
+	EventToolUse
+	// EventUsage carries the token counts seen so far in Usage.
+	EventUsage
+	// EventStop ends the stream with StopReason.
+	EventStop
+)
+
+// Event is one piece of a streamed response.
+type Event struct {
+	Type       EventType
+	Index      int
+	Text       string
+	ToolID     string
+	ToolName   string
+	StopReason string
+	Usage      Usage
+}
+
+// Handler receives the events of a stream as they arrive.
+type Handler interface {
+	HandleEvent(Event)
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(Event)
+
+func (f HandlerFunc) HandleEvent(e Event) {
+	f(e)
+}
+
+// TextWriter returns a Handler writing only the answer text to w.
+func TextWriter(w io.Writer) Handler {
+	return HandlerFunc(func(e Event) {
+		if e.Type == EventText {
+			io.WriteString(w, e.Text)
+		}
+	})
+}
+
+const (
+	ansiDim   = "\x1b[2m"
+	ansiReset = "\x1b[0m"
+)
+
+// Terminal renders a stream for an interactive terminal: the answer as
+// plain text, reasoning dimmed and tool calls as a one line notice.
+type Terminal struct {
+	W io.Writer
+
+	dimmed bool
+}
+
+func NewTerminal(w io.Writer) *Terminal {
+	return &Terminal{W: w}
+}
+
+func (t *Terminal) HandleEvent(e Event) {
+	switch e.Type {
+	case EventText:
+		t.dim(false)
+		io.WriteString(t.W, e.Text)
+	case EventThinking:
+		t.dim(true)
+		io.WriteString(t.W, e.Text)
+	case EventToolUse:
+		if e.ToolName != "" {
+			t.dim(true)
+			fmt.Fprintf(t.W, "\n[%s]\n", e.ToolName)
+		}
+	case EventStop:
+		t.dim(false)
+	}
+}
+
+func (t *Terminal) dim(on bool) {
+	if on == t.dimmed {
+		return
+	}
+	if on {
+		io.WriteString(t.W, ansiDim)
+	} else {
+		io.WriteString(t.W, ansiReset+"\n")
+	}
+	t.dimmed = on
+}
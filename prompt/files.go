@@ -1,15 +1,75 @@
 package prompt
 
 import (
+	"aaai/ignore"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
+// maxFiles bounds the files sent when no token budget is known.
 const maxFiles = 90
 
-func AssembleFiles(dir string) []FileContent {
-	buffer := []FileContent{}
+// RecentlyModified is how long before the newest file in the tree a file
+// may have changed and still rank ahead of files that are merely relevant.
+const RecentlyModified = 24 * time.Hour
+
+// Selection says how many tokens AssembleFiles may spend and which files
+// deserve them most.
+type Selection struct {
+	// Budget is the number of tokens the files may take; a negative
+	// budget falls back to a fixed number of files.
+	Budget int
+
+	// Request is the user's request. Files it names come first and the
+	// rest are ranked by the words they share with it.
+	Request string
+}
+
+// EstimateTokens approximates the number of tokens s takes, at about four
+// bytes a token.
+func EstimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// fileTokens estimates a file as it is rendered in the prompt, with its
+// name and code fence.
+func fileTokens(fc FileContent) int {
+	return EstimateTokens(fc.Content) + EstimateTokens(fc.Filename) + 4
+}
+
+type candidate struct {
+	file      FileContent
+	modified  time.Time
+	named     bool
+	relevance int
+}
+
+// sourceExtensions are the files AssembleFiles considers.
+var sourceExtensions = []string{".go", ".html", ".css", ".js"}
+
+func isSource(name string) bool {
+	for _, ext := range sourceExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// AssembleFiles reads the source files under dir that are not ignored by
+// .gitignore or .aaaiignore and returns, in path order, the highest
+// ranked ones that fit the selection's budget. Files
+// named in the request come first, then recently modified ones, then those
+// most relevant to the request. It also returns the files left out.
+func AssembleFiles(dir string, sel Selection) ([]FileContent, []string) {
+	var candidates []candidate
+	words := requestWords(sel.Request)
+	ignored := ignore.New(dir)
 
 	// Walk through directory recursively
 	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
@@ -17,35 +77,231 @@ func AssembleFiles(dir string) []FileContent {
 			return nil
 		}
 
-		// Check if we've reached the max files limit
-		if len(buffer) >= maxFiles {
-			return filepath.SkipDir
+		// Get relative path from root dir
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
 		}
 
-		// Skip directories
+		// Skip ignored directories without descending
 		if info.IsDir() {
+			if relPath != "." && ignored.Ignored(relPath, true) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		// Only process .go files
-		name := info.Name()
-		if !strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, ".html") && !strings.HasSuffix(name, ".css") && !strings.HasSuffix(name, ".js") {
+		// Only process source files
+		if !isSource(info.Name()) || ignored.Ignored(relPath, false) {
 			return nil
 		}
 
-		// Get relative path from root dir
-		relPath, err := filepath.Rel(dir, path)
+		content, err := os.ReadFile(path)
 		if err != nil {
 			return nil
 		}
+		fc := FileContent{Filename: relPath, Content: string(content)}
+		candidates = append(candidates, candidate{
+			file:      fc,
+			modified:  info.ModTime(),
+			named:     named(relPath, sel.Request),
+			relevance: relevance(fc, words),
+		})
+		return nil
+	})
 
-		fc := FileContent{}
-		fc.Filename = relPath
-		goFile, _ := os.ReadFile(path)
-		fc.Content = string(goFile)
-		buffer = append(buffer, fc)
+	// Recency counts from the newest file rather than the clock: after a
+	// clone or checkout every file looks new, and relevance must still
+	// decide between them.
+	var newest time.Time
+	for _, c := range candidates {
+		if c.modified.After(newest) {
+			newest = c.modified
+		}
+	}
+	recent := func(c candidate) bool { return newest.Sub(c.modified) < RecentlyModified }
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.named != b.named {
+			return a.named
+		}
+		if recent(a) != recent(b) {
+			return recent(a)
+		}
+		if a.relevance != b.relevance {
+			return a.relevance > b.relevance
+		}
+		return a.modified.After(b.modified)
+	})
+
+	var files []FileContent
+	var dropped []string
+	used := 0
+	for _, c := range candidates {
+		tokens := fileTokens(c.file)
+		full := used+tokens > sel.Budget
+		if sel.Budget < 0 {
+			full = len(files) >= maxFiles
+		}
+		if full {
+			dropped = append(dropped, c.file.Filename)
+			continue
+		}
+		used += tokens
+		files = append(files, c.file)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Filename < files[j].Filename })
+	sort.Strings(dropped)
+	return files, dropped
+}
+
+// ListFiles returns the slash separated paths of every file under dir that
+// is not ignored, whatever its type.
+func ListFiles(dir string) []string {
+	var paths []string
+	ignored := ignore.New(dir)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil || relPath == "." {
+			return nil
+		}
+		if ignored.Ignored(relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			paths = append(paths, filepath.ToSlash(relPath))
+		}
 		return nil
 	})
+	return paths
+}
+
+// Explain tells why the file at path, relative to dir, is or isn't
+// considered by AssembleFiles.
+func Explain(dir, path string) (string, error) {
+	info, err := os.Stat(filepath.Join(dir, path))
+	if err != nil {
+		return "", err
+	}
+	m := ignore.New(dir)
+	d := m.Explain(path, info.IsDir())
+	var why string
+	switch {
+	case d.Ignored:
+		why = fmt.Sprintf("%s: excluded, %s", path, d)
+	case info.IsDir():
+		why = fmt.Sprintf("%s: searched, %s", path, d)
+	case !isSource(info.Name()):
+		why = fmt.Sprintf("%s: excluded, only %s files are sent", path, strings.Join(sourceExtensions, " "))
+	default:
+		why = fmt.Sprintf("%s: included, %s", path, d)
+	}
+	// Bad lines are left out of the ignore files; say so, as they may be
+	// why a file is unexpectedly included.
+	for _, err := range m.Errors() {
+		why += "\nwarning: skipped " + err.Error()
+	}
+	return why, nil
+}
+
+// named reports whether request names the file at relPath, by its path
+// or as a whole word by its base name.
+func named(relPath, request string) bool {
+	slashed := filepath.ToSlash(relPath)
+	return request != "" && (strings.Contains(request, slashed) || mentions(request, filepath.Base(relPath)))
+}
+
+var wordPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{2,}`)
 
-	return buffer
+// mentions reports whether text contains name as a whole word.
+func mentions(text, name string) bool {
+	for _, i := range indexAll(text, name) {
+		before := i == 0 || !isWordByte(text[i-1])
+		after := i+len(name) == len(text) || !isWordByte(text[i+len(name)])
+		if before && after {
+			return true
+		}
+	}
+	return false
+}
+
+func indexAll(s, sub string) []int {
+	var out []int
+	for i := 0; ; {
+		j := strings.Index(s[i:], sub)
+		if j < 0 {
+			return out
+		}
+		out = append(out, i+j)
+		i += j + 1
+	}
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// requestWords returns the distinct identifiers of a request, lower cased.
+func requestWords(request string) []string {
+	seen := map[string]bool{}
+	var words []string
+	for _, w := range wordPattern.FindAllString(request, -1) {
+		w = strings.ToLower(w)
+		if !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// relevance counts how many of the request's words occur in the file's
+// path or content.
+func relevance(fc FileContent, words []string) int {
+	path := strings.ToLower(fc.Filename)
+	content := strings.ToLower(fc.Content)
+	score := 0
+	for _, w := range words {
+		if strings.Contains(path, w) {
+			score += 2
+		}
+		if strings.Contains(content, w) {
+			score++
+		}
+	}
+	return score
+}
+
+// StableOrder arranges files so that a provider's prompt cache can reuse
+// the previous request: files unchanged since prev come first in their
+// previous order, followed by new and changed files. It returns the
+// arranged files and how many of them lead unchanged.
+func StableOrder(prev, files []FileContent) ([]FileContent, int) {
+	current := make(map[string]FileContent, len(files))
+	for _, f := range files {
+		current[f.Filename] = f
+	}
+
+	ordered := make([]FileContent, 0, len(files))
+	unchanged := map[string]bool{}
+	for _, f := range prev {
+		if c, ok := current[f.Filename]; ok && c.Content == f.Content {
+			ordered = append(ordered, c)
+			unchanged[f.Filename] = true
+		}
+	}
+	stable := len(ordered)
+	for _, f := range files {
+		if !unchanged[f.Filename] {
+			ordered = append(ordered, f)
+		}
+	}
+	return ordered, stable
 }
@@ -0,0 +1,134 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStableOrder(t *testing.T) {
+	fc := func(name, content string) FileContent {
+		return FileContent{Filename: name, Content: content}
+	}
+	prev := []FileContent{fc("a.go", "a"), fc("c.go", "c"), fc("b.go", "b"), fc("d.go", "d")}
+	files := []FileContent{fc("a.go", "a"), fc("b.go", "b2"), fc("c.go", "c"), fc("e.go", "e")}
+
+	got, stable := StableOrder(prev, files)
+	want := []FileContent{fc("a.go", "a"), fc("c.go", "c"), fc("b.go", "b2"), fc("e.go", "e")}
+	if !reflect.DeepEqual(got, want) || stable != 2 {
+		t.Errorf("got %v, %d stable; want %v, 2 stable", got, stable, want)
+	}
+
+	if _, stable := StableOrder(nil, files); stable != 0 {
+		t.Errorf("got %d stable files on the first request", stable)
+	}
+}
+
+func TestAssembleFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	write := func(name, content string, modified time.Time) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+		os.Chtimes(path, modified, modified)
+	}
+	filler := strings.Repeat("x", 400) // 100 tokens
+	write("a.go", "package a\n"+filler, old)
+	write("b.go", "package b\n"+filler, old)
+	write("c/recent.go", "package c\n"+filler, time.Now())
+	write("d.go", "package d // parser\n"+filler, old)
+	write("notes.txt", "not source", time.Now())
+
+	names := func(files []FileContent) []string {
+		var out []string
+		for _, f := range files {
+			out = append(out, f.Filename)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		sel     Selection
+		files   []string
+		dropped []string
+	}{
+		{"no budget", Selection{Budget: -1}, []string{"a.go", "b.go", "c/recent.go", "d.go"}, nil},
+		{"recent first", Selection{Budget: 250}, []string{"a.go", "c/recent.go"}, []string{"b.go", "d.go"}},
+		{"relevance", Selection{Budget: 250, Request: "fix the Parser"}, []string{"c/recent.go", "d.go"}, []string{"a.go", "b.go"}},
+		{"named", Selection{Budget: 150, Request: "rename in b.go."}, []string{"b.go"}, []string{"a.go", "c/recent.go", "d.go"}},
+		{"nothing fits", Selection{Budget: 0}, nil, []string{"a.go", "b.go", "c/recent.go", "d.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, dropped := AssembleFiles(dir, tt.sel)
+			if got := names(files); !reflect.DeepEqual(got, tt.files) {
+				t.Errorf("got files %v, want %v", got, tt.files)
+			}
+			if !reflect.DeepEqual(dropped, tt.dropped) {
+				t.Errorf("got dropped %v, want %v", dropped, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestAssembleFilesCheckout(t *testing.T) {
+	// After a fresh checkout every file is new, so relevance decides.
+	dir := t.TempDir()
+	filler := strings.Repeat("x", 400) // 100 tokens
+	for name, content := range map[string]string{
+		"a.go": "package a\n" + filler,
+		"b.go": "package b\n" + filler,
+		"d.go": "package d // parser\n" + filler,
+	} {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	os.Chtimes(filepath.Join(dir, "d.go"), time.Now().Add(-time.Minute), time.Now().Add(-time.Minute))
+
+	files, _ := AssembleFiles(dir, Selection{Budget: 150, Request: "fix the parser"})
+	if len(files) != 1 || files[0].Filename != "d.go" {
+		t.Errorf("got %v, want just d.go", files)
+	}
+}
+
+func TestAssembleFilesIgnored(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		".gitignore":          "gen/\n",
+		"main.go":             "package main",
+		"gen/api.go":          "package gen",
+		"vendor/dep/dep.go":   "package dep",
+		"node_modules/x/x.js": "x()",
+		"README.md":           "# readme",
+	} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	files, _ := AssembleFiles(dir, Selection{Budget: -1})
+	if len(files) != 1 || files[0].Filename != "main.go" {
+		t.Errorf("got %v, want just main.go", files)
+	}
+
+	for path, want := range map[string]string{
+		"main.go":    "main.go: included, no ignore pattern matches",
+		"gen/api.go": "gen/api.go: excluded, directory gen/ is ignored by .gitignore:1: gen/",
+		"README.md":  "README.md: excluded, only .go .html .css .js files are sent",
+	} {
+		if got, err := Explain(dir, path); err != nil || got != want {
+			t.Errorf("Explain(%s) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+
+	os.MkdirAll(filepath.Join(dir, "bad"), 0755)
+	os.WriteFile(filepath.Join(dir, "bad", ".gitignore"), []byte("[z-a].go\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "bad", "x.go"), []byte("package bad"), 0644)
+	if got, _ := Explain(dir, "bad/x.go"); !strings.Contains(got, "warning: skipped bad/.gitignore:1") {
+		t.Errorf("bad pattern not reported: %q", got)
+	}
+}
@@ -2,15 +2,15 @@ package prompt
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 )
 
-func NewPromptManager(request string) *PromptManager {
-	return &PromptManager{
-		SystemPrompt: `You are a skilled programmer helping edit code, using unified diffs.
+const systemPrompt = `You are a skilled programmer helping edit code, using unified diffs.
 Follow the indentation and style of the existing code.
 Keep line length to 80 characters or less unless other conventions override.
 Update all imports needed by your changes.
@@ -19,8 +19,30 @@ Always include 100% of the diffs for a single file in just one file between Code
 For example do not list 2 ranges of diffs for foo.txt and then a CodeFence and then one
 more diff for foo.txt. Instead all 3 diffs should be together for foo.txt file.
 Make sure to list +++ and the filename and --- and the filename at start of each diff.
-Use unified diff format with 3 lines of context.` + request,
-		CodeFence: "```",
+Use unified diff format with 3 lines of context.
+Only edit files whose full contents you were shown.
+Files marked (read-only) are for reference; do not edit them.`
+
+// Prompt is a request split into the parts each API sends through
+// different channels. System and Context go ahead of the conversation,
+// where they form a prefix providers can cache, and Request is the user
+// message.
+type Prompt struct {
+	System string
+
+	// Context holds one block per file, followed by the repository
+	// outline if any. The first Stable blocks are unchanged since the
+	// previous request.
+	Context []string
+	Stable  int
+
+	Request string
+}
+
+func NewPromptManager() *PromptManager {
+	return &PromptManager{
+		SystemPrompt: systemPrompt,
+		CodeFence:    "```",
 	}
 }
 
@@ -37,14 +59,56 @@ func (pm *PromptManager) AddFile(filename string) error {
 	return nil
 }
 
-func (pm *PromptManager) BuildPrompt(userRequest string) string {
-	var buf bytes.Buffer
+// ConventionsFile holds a project's rules for generated code. It is sent
+// when no other conventions are configured.
+const ConventionsFile = "CONVENTIONS.md"
 
-	buf.WriteString(pm.SystemPrompt)
-	buf.WriteString("\n\n")
+// LoadConventions adds the files in paths, relative to dir unless
+// absolute, as read-only context; with no paths it adds ConventionsFile
+// if dir has one. Call it before adding the files to edit, so that the
+// conventions come first. Files that can't be read are reported in the
+// error and skipped.
+func (pm *PromptManager) LoadConventions(dir string, paths []string) error {
+	if len(paths) == 0 {
+		if _, err := os.Stat(filepath.Join(dir, ConventionsFile)); err != nil {
+			return nil
+		}
+		paths = []string{ConventionsFile}
+	}
+
+	var errs []error
+	for _, path := range paths {
+		full := path
+		if !filepath.IsAbs(path) {
+			full = filepath.Join(dir, path)
+		}
+		content, err := os.ReadFile(full)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error reading conventions: %w", err))
+			continue
+		}
+		pm.Files = append(pm.Files, FileContent{
+			Filename: path,
+			Content:  string(content),
+			ReadOnly: true,
+		})
+	}
+	return errors.Join(errs...)
+}
+
+func (pm *PromptManager) BuildPrompt(userRequest string) Prompt {
+	return Prompt{
+		System:  pm.SystemPrompt,
+		Context: pm.buildContext(),
+		Request: userRequest,
+	}
+}
+
+func (pm *PromptManager) buildContext() []string {
+	var blocks []string
 
 	for _, file := range pm.Files {
-		fmt.Println(file.Filename)
+		var buf bytes.Buffer
 		ext := filepath.Ext(file.Filename)
 		lang := strings.TrimPrefix(ext, ".")
 		if lang == "" {
@@ -52,6 +116,9 @@ func (pm *PromptManager) BuildPrompt(userRequest string) string {
 		}
 
 		buf.WriteString(file.Filename)
+		if file.ReadOnly {
+			buf.WriteString(" (read-only)")
+		}
 		buf.WriteString("\n")
 		buf.WriteString(pm.CodeFence)
 		buf.WriteString(lang)
@@ -62,17 +129,22 @@ func (pm *PromptManager) BuildPrompt(userRequest string) string {
 		}
 		buf.WriteString(pm.CodeFence)
 		buf.WriteString("\n\n")
+		blocks = append(blocks, buf.String())
+	}
+
+	// The outline goes last so that it doesn't break the cached prefix of
+	// unchanged files when it changes.
+	if pm.RepoMap != "" {
+		blocks = append(blocks, "Outline of the other Go files in the repository:\n"+pm.RepoMap+"\n")
 	}
 
-	buf.WriteString(userRequest)
-	return buf.String()
+	return blocks
 }
 
-func MakePrompt(request string, files []FileContent) string {
-	pm := NewPromptManager(request)
+func MakePrompt(request string, files []FileContent) Prompt {
+	pm := NewPromptManager()
 
 	pm.Files = files
 
-	prompt := pm.BuildPrompt(request)
-	return prompt
+	return pm.BuildPrompt(request)
 }
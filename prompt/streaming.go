@@ -6,38 +6,310 @@ import (
 	"strings"
 )
 
+// StreamError is an error event received in the middle of a stream.
+type StreamError struct {
+	Type    string
+	Message string
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("stream error (%s): %s", e.Type, e.Message)
+}
+
+// StreamParser turns a streamed response into Events for its Handler
+// while collecting the answer text, stop reason and usage.
 type StreamParser struct {
-	buffer strings.Builder
+	buffer     strings.Builder
+	stopReason string
+	done       bool
+	usage      Usage
+
+	// pending accumulates the JSON input of tool calls by block index
+	// until their content_block_stop.
+	pending   map[int]*pendingToolCall
+	toolCalls []ToolCall
+
+	// reasoning collects every thinking delta, and thinking the complete
+	// Anthropic thinking blocks with their signatures.
+	reasoning       strings.Builder
+	pendingThinking map[int]*ThinkingBlock
+	thinking        []ThinkingBlock
+
+	// think tracks <think> tags in text deltas; held is text kept back
+	// until it is known whether it belongs to a tag.
+	think     thinkState
+	held      string
+	trimStart bool
+
+	// Handler receives every event; nil discards them.
+	Handler Handler
 }
 
-func NewStreamParser() *StreamParser {
-	return &StreamParser{}
+func NewStreamParser(h Handler) *StreamParser {
+	return &StreamParser{Handler: h}
 }
 
+// ProcessLine handles the data of one Anthropic server-sent event.
 func (p *StreamParser) ProcessLine(line string) error {
 
 	var m map[string]any
 
-	json.Unmarshal([]byte(line), &m)
-	if m["type"] == "content_block_delta" {
-
-		d := m["delta"].(map[string]any)
-		s := d["text"].(string)
-		fmt.Print(s)
-		p.buffer.WriteString(s)
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		return fmt.Errorf("error decoding stream event %q: %w", strings.TrimSpace(line), err)
+	}
+	index := count(m, "index")
+	switch m["type"] {
+	case "message_start":
+		msg, _ := m["message"].(map[string]any)
+		u, _ := msg["usage"].(map[string]any)
+		p.SetUsage(Usage{
+			InputTokens:      count(u, "input_tokens"),
+			OutputTokens:     count(u, "output_tokens"),
+			CacheReadTokens:  count(u, "cache_read_input_tokens"),
+			CacheWriteTokens: count(u, "cache_creation_input_tokens"),
+		})
+	case "content_block_start":
+		b, _ := m["content_block"].(map[string]any)
+		switch b["type"] {
+		case "thinking", "redacted_thinking":
+			data, _ := b["data"].(string)
+			if p.pendingThinking == nil {
+				p.pendingThinking = map[int]*ThinkingBlock{}
+			}
+			p.pendingThinking[index] = &ThinkingBlock{Data: data}
+		case "tool_use":
+			id, _ := b["id"].(string)
+			name, _ := b["name"].(string)
+			if p.pending == nil {
+				p.pending = map[int]*pendingToolCall{}
+			}
+			p.pending[index] = &pendingToolCall{id: id, name: name}
+			p.send(Event{Type: EventToolUse, Index: index, ToolID: id, ToolName: name})
+		}
+	case "content_block_delta":
+		d, _ := m["delta"].(map[string]any)
+		switch d["type"] {
+		case "thinking_delta":
+			s, _ := d["thinking"].(string)
+			if b := p.pendingThinking[index]; b != nil {
+				b.Text += s
+			}
+			p.reasoning.WriteString(s)
+			p.send(Event{Type: EventThinking, Index: index, Text: s})
+		case "signature_delta":
+			if b := p.pendingThinking[index]; b != nil {
+				b.Signature, _ = d["signature"].(string)
+			}
+		case "input_json_delta":
+			s, _ := d["partial_json"].(string)
+			if call := p.pending[index]; call != nil {
+				call.input.WriteString(s)
+			}
+			p.send(Event{Type: EventToolUse, Index: index, Text: s})
+		default:
+			if s, ok := d["text"].(string); ok {
+				p.buffer.WriteString(s)
+				p.send(Event{Type: EventText, Index: index, Text: s})
+			}
+		}
+	case "content_block_stop":
+		if b := p.pendingThinking[index]; b != nil {
+			delete(p.pendingThinking, index)
+			p.thinking = append(p.thinking, *b)
+		}
+		if call := p.pending[index]; call != nil {
+			delete(p.pending, index)
+			input := strings.TrimSpace(call.input.String())
+			if input == "" {
+				input = "{}"
+			}
+			if !json.Valid([]byte(input)) {
+				return fmt.Errorf("invalid input for tool %s: %q", call.name, input)
+			}
+			p.toolCalls = append(p.toolCalls, ToolCall{ID: call.id, Name: call.name, Input: json.RawMessage(input)})
+		}
+	case "message_delta":
+		d, _ := m["delta"].(map[string]any)
+		if s, ok := d["stop_reason"].(string); ok {
+			p.stopReason = s
+		}
+		// The output count in message_delta is cumulative.
+		u, _ := m["usage"].(map[string]any)
+		if _, ok := u["output_tokens"]; ok {
+			usage := p.usage
+			usage.OutputTokens = count(u, "output_tokens")
+			p.SetUsage(usage)
+		}
+	case "message_stop":
+		p.Finish(p.stopReason)
+	case "error":
+		e, _ := m["error"].(map[string]any)
+		typ, _ := e["type"].(string)
+		msg, _ := e["message"].(string)
+		return &StreamError{Type: typ, Message: msg}
 	}
 
 	return nil
 }
 
+// ProcessLineAsString handles a text delta already extracted from a
+// stream. A <think> block at the start of the answer, as written by R1
+// style models, is reported as reasoning instead of text.
 func (p *StreamParser) ProcessLineAsString(s string) error {
-
-	fmt.Print(s)
-	p.buffer.WriteString(s)
+	for s != "" {
+		switch p.think {
+		case thinkUnknown:
+			p.held += s
+			s = ""
+			head := strings.TrimLeft(p.held, " \t\r\n")
+			if strings.HasPrefix(head, thinkOpen) {
+				p.think = thinkInside
+				p.held = ""
+				s = head[len(thinkOpen):]
+			} else if !strings.HasPrefix(thinkOpen, head) {
+				p.think = thinkOutside
+				s, p.held = p.held, ""
+			}
+		case thinkInside:
+			text := p.held + s
+			p.held, s = "", ""
+			if i := strings.Index(text, thinkClose); i >= 0 {
+				p.ProcessReasoning(text[:i])
+				p.think = thinkOutside
+				p.trimStart = true
+				s = text[i+len(thinkClose):]
+			} else {
+				// Keep back what may be the start of the closing tag.
+				n := partialSuffix(text, thinkClose)
+				p.ProcessReasoning(text[:len(text)-n])
+				p.held = text[len(text)-n:]
+			}
+		case thinkOutside:
+			if p.trimStart {
+				s = strings.TrimLeft(s, "\r\n")
+				if s == "" {
+					return nil
+				}
+				p.trimStart = false
+			}
+			p.buffer.WriteString(s)
+			p.send(Event{Type: EventText, Text: s})
+			s = ""
+		}
+	}
 	return nil
 }
 
+// ProcessReasoning handles a reasoning delta that a stream sends apart
+// from the answer text.
+func (p *StreamParser) ProcessReasoning(s string) {
+	if s == "" {
+		return
+	}
+	p.reasoning.WriteString(s)
+	p.send(Event{Type: EventThinking, Text: s})
+}
+
+// flush hands on text held back while looking for a tag.
+func (p *StreamParser) flush() {
+	held := p.held
+	p.held = ""
+	switch p.think {
+	case thinkInside:
+		p.ProcessReasoning(held)
+	case thinkUnknown:
+		p.think = thinkOutside
+		p.ProcessLineAsString(held)
+	}
+}
+
+func (p *StreamParser) send(e Event) {
+	if p.Handler != nil {
+		p.Handler.HandleEvent(e)
+	}
+}
+
+// Finish records the end of the stream with the reason the model
+// stopped. Formats with a message_stop event call it from ProcessLine.
+func (p *StreamParser) Finish(stopReason string) {
+	p.flush()
+	p.stopReason = stopReason
+	p.done = true
+	p.send(Event{Type: EventStop, StopReason: stopReason})
+}
+
+// SetUsage records the token counts seen so far.
+func (p *StreamParser) SetUsage(u Usage) {
+	p.usage = u
+	p.send(Event{Type: EventUsage, Usage: u})
+}
+
+// ToolCalls returns the tool calls completed so far, in stream order.
+func (p *StreamParser) ToolCalls() []ToolCall {
+	return p.toolCalls
+}
+
+// Reasoning returns the reasoning text seen so far.
+func (p *StreamParser) Reasoning() string {
+	return p.reasoning.String()
+}
+
+// Thinking returns the complete thinking blocks, in stream order.
+func (p *StreamParser) Thinking() []ThinkingBlock {
+	return p.thinking
+}
+
+// Usage returns the token counts seen so far.
+func (p *StreamParser) Usage() Usage {
+	return p.usage
+}
+
+// Done reports whether the end of the message was seen.
+func (p *StreamParser) Done() bool {
+	return p.done
+}
+
+// StopReason returns why the model stopped, empty until it is known.
+func (p *StreamParser) StopReason() string {
+	return p.stopReason
+}
+
 // GetResult returns the final concatenated text
 func (p *StreamParser) Result() string {
 	return p.buffer.String()
 }
+
+type thinkState int
+
+const (
+	thinkUnknown thinkState = iota
+	thinkInside
+	thinkOutside
+)
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// partialSuffix returns the length of the longest suffix of s that is a
+// proper prefix of tag.
+func partialSuffix(s, tag string) int {
+	for n := min(len(s), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+type pendingToolCall struct {
+	id    string
+	name  string
+	input strings.Builder
+}
+
+func count(m map[string]any, key string) int {
+	n, _ := m[key].(float64)
+	return int(n)
+}
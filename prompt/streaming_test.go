@@ -0,0 +1,116 @@
+package prompt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestStreamParserEvents(t *testing.T) {
+	lines := []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":10,"cache_read_input_tokens":5,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hmm"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"read_file","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"path\":"}}`,
+		`{"type":"ping"}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":7}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	var events []Event
+	p := NewStreamParser(HandlerFunc(func(e Event) { events = append(events, e) }))
+	for _, line := range lines {
+		if err := p.ProcessLine(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []Event{
+		{Type: EventUsage, Usage: Usage{InputTokens: 10, OutputTokens: 1, CacheReadTokens: 5}},
+		{Type: EventThinking, Text: "hmm"},
+		{Type: EventText, Index: 1, Text: "Hi"},
+		{Type: EventToolUse, Index: 2, ToolID: "toolu_1", ToolName: "read_file"},
+		{Type: EventToolUse, Index: 2, Text: `{"path":`},
+		{Type: EventUsage, Usage: Usage{InputTokens: 10, OutputTokens: 7, CacheReadTokens: 5}},
+		{Type: EventStop, StopReason: "tool_use"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got events\n%+v\nwant\n%+v", events, want)
+	}
+	if p.Result() != "Hi" || !p.Done() || p.StopReason() != "tool_use" {
+		t.Errorf("got result %q, done %v, stop %q", p.Result(), p.Done(), p.StopReason())
+	}
+	if want := []ThinkingBlock{{Text: "hmm", Signature: "sig"}}; !reflect.DeepEqual(p.Thinking(), want) {
+		t.Errorf("got thinking %+v, want %+v", p.Thinking(), want)
+	}
+}
+
+func TestThinkTags(t *testing.T) {
+	tests := []struct {
+		name          string
+		deltas        []string
+		text, thought string
+	}{
+		{"none", []string{"no tags ", "<think>here</think>"}, "no tags <think>here</think>", ""},
+		{"whole", []string{"<think>plan</think>\n\nanswer"}, "answer", "plan"},
+		{"split tags", []string{"\n<thi", "nk>pl", "an</th", "ink>", "\n", "answer"}, "answer", "plan"},
+		{"lookalike", []string{"<th", "ing>"}, "<thing>", ""},
+		{"short", []string{"<t"}, "<t", ""},
+		{"unclosed", []string{"<think>still going</thi"}, "", "still going</thi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var thought string
+			p := NewStreamParser(HandlerFunc(func(e Event) {
+				if e.Type == EventThinking {
+					thought += e.Text
+				}
+			}))
+			for _, d := range tt.deltas {
+				p.ProcessLineAsString(d)
+			}
+			p.Finish("end_turn")
+			if p.Result() != tt.text {
+				t.Errorf("got text %q, want %q", p.Result(), tt.text)
+			}
+			if thought != tt.thought || p.Reasoning() != tt.thought {
+				t.Errorf("got reasoning %q (events %q), want %q", p.Reasoning(), thought, tt.thought)
+			}
+		})
+	}
+}
+
+func TestStreamParserErrors(t *testing.T) {
+	p := NewStreamParser(nil)
+	if err := p.ProcessLine(`{"type":"content_block_delta",`); err == nil {
+		t.Error("expected error for malformed JSON")
+	}
+
+	err := p.ProcessLine(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+	se, ok := err.(*StreamError)
+	if !ok || se.Type != "overloaded_error" {
+		t.Errorf("got %v, want StreamError", err)
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	var buf bytes.Buffer
+	term := NewTerminal(&buf)
+	for _, e := range []Event{
+		{Type: EventThinking, Text: "plan"},
+		{Type: EventText, Text: "answer"},
+		{Type: EventStop},
+	} {
+		term.HandleEvent(e)
+	}
+
+	want := ansiDim + "plan" + ansiReset + "\n" + "answer"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
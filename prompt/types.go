@@ -1,17 +1,85 @@
 package prompt
 
+import "encoding/json"
+
 type Message struct {
 	Role    string
 	Content string
+
+	// ToolCalls are the calls made by an assistant message and
+	// ToolResults the answers to them sent back in the next user message.
+	ToolCalls   []ToolCall
+	ToolResults []ToolResult
+
+	// Attachments are PDFs and images sent with a user message.
+	Attachments []Attachment
+
+	// Thinking holds the reasoning blocks of an assistant message that
+	// must be sent back unchanged alongside its tool calls.
+	Thinking []ThinkingBlock
+}
+
+// ThinkingBlock is a block of model reasoning with the signature that
+// lets the API verify it when it is sent back. Redacted blocks carry only
+// encrypted Data.
+type ThinkingBlock struct {
+	Text      string
+	Signature string
+	Data      string
+}
+
+// Tool declares a function the model may call. InputSchema is the JSON
+// Schema of the call's input object.
+type Tool struct {
+	Name        string
+	Description string
+	InputSchema json.RawMessage
+}
+
+// ToolCall is a complete call of a Tool by the model.
+type ToolCall struct {
+	ID    string
+	Name  string
+	Input json.RawMessage
+}
+
+// ToolResult answers the ToolCall with the same ID.
+type ToolResult struct {
+	ToolCallID string
+	Content    string
+	IsError    bool
 }
 
 type FileContent struct {
 	Filename string
 	Content  string
+
+	// ReadOnly files are shown for reference; the model is told not to
+	// edit them.
+	ReadOnly bool
 }
 
 type PromptManager struct {
 	SystemPrompt string
 	Files        []FileContent
 	CodeFence    string
+
+	// RepoMap outlines the files that are not sent in full.
+	RepoMap string
+}
+
+// Usage counts the tokens of one or more completions. InputTokens excludes
+// tokens read from or written to the prompt cache.
+type Usage struct {
+	InputTokens      int
+	OutputTokens     int
+	CacheReadTokens  int
+	CacheWriteTokens int
+}
+
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheReadTokens += other.CacheReadTokens
+	u.CacheWriteTokens += other.CacheWriteTokens
 }
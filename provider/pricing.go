@@ -0,0 +1,41 @@
+package provider
+
+import "aaai/prompt"
+
+// Price is the cost of a model in US dollars per million tokens.
+type Price struct {
+	Input      float64
+	Output     float64
+	CacheRead  float64
+	CacheWrite float64
+}
+
+// Prices lists the published prices of the built-in models by name.
+var Prices = map[string]Price{
+	"claude-3-7-sonnet-20250219": {Input: 3, Output: 15, CacheRead: 0.30, CacheWrite: 3.75},
+	"claude-sonnet-4-20250514":   {Input: 3, Output: 15, CacheRead: 0.30, CacheWrite: 3.75},
+	"claude-opus-4-20250514":     {Input: 15, Output: 75, CacheRead: 1.50, CacheWrite: 18.75},
+	"claude-3-5-sonnet-20241022": {Input: 3, Output: 15, CacheRead: 0.30, CacheWrite: 3.75},
+	"claude-3-5-haiku-20241022":  {Input: 0.80, Output: 4, CacheRead: 0.08, CacheWrite: 1},
+
+	"deepseek-chat":     {Input: 0.27, Output: 1.10, CacheRead: 0.07},
+	"deepseek-reasoner": {Input: 0.55, Output: 2.19, CacheRead: 0.14},
+
+	"deepseek-r1-distill-llama-70b": {Input: 0.75, Output: 0.99},
+	"llama-3.3-70b-versatile":       {Input: 0.59, Output: 0.79},
+	"llama-3.1-8b-instant":          {Input: 0.05, Output: 0.08},
+}
+
+// Cost returns the price of usage on model, and false when the model's
+// price is unknown.
+func Cost(model string, u prompt.Usage) (float64, bool) {
+	p, ok := Prices[model]
+	if !ok {
+		return 0, false
+	}
+	cost := float64(u.InputTokens)*p.Input +
+		float64(u.OutputTokens)*p.Output +
+		float64(u.CacheReadTokens)*p.CacheRead +
+		float64(u.CacheWriteTokens)*p.CacheWrite
+	return cost / 1e6, true
+}
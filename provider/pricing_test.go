@@ -0,0 +1,25 @@
+package provider
+
+import (
+	"aaai/prompt"
+	"math"
+	"testing"
+)
+
+func TestCost(t *testing.T) {
+	u := prompt.Usage{
+		InputTokens:      1000000,
+		OutputTokens:     100000,
+		CacheReadTokens:  2000000,
+		CacheWriteTokens: 400000,
+	}
+	got, ok := Cost("claude-3-7-sonnet-20250219", u)
+	// 3 + 1.5 + 0.6 + 1.5
+	if !ok || math.Abs(got-6.6) > 1e-9 {
+		t.Errorf("got %v, %v, want 6.6", got, ok)
+	}
+
+	if _, ok := Cost("my-local-model", u); ok {
+		t.Error("expected unknown price for unlisted model")
+	}
+}
@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"aaai/prompt"
+	"context"
+	"errors"
+)
+
+// ModelInfo describes the model a Provider sends requests to.
+type ModelInfo struct {
+	Name            string
+	ContextWindow   int
+	MaxOutputTokens int
+}
+
+// Capabilities lists the optional features a Provider supports.
+type Capabilities struct {
+	Streaming    bool
+	SystemPrompt bool
+	Tools        bool
+	Attachments  bool
+	Reasoning    bool
+}
+
+// StopReason tells why the model stopped generating.
+type StopReason string
+
+const (
+	StopEndTurn   StopReason = "end_turn"
+	StopSequence  StopReason = "stop_sequence"
+	StopMaxTokens StopReason = "max_tokens"
+	StopToolUse   StopReason = "tool_use"
+)
+
+// ErrIncomplete is returned when a stream ends before the message does,
+// for example because the connection dropped.
+var ErrIncomplete = errors.New("stream ended before the response was complete")
+
+// Response is the result of a completion.
+type Response struct {
+	Text       string
+	StopReason StopReason
+	Usage      prompt.Usage
+
+	// ToolCalls are set when StopReason is StopToolUse.
+	ToolCalls []prompt.ToolCall
+
+	// Reasoning is the model's thinking, kept apart from Text. Thinking
+	// holds the blocks that must be sent back with ToolCalls.
+	Reasoning string
+	Thinking  []prompt.ThinkingBlock
+}
+
+// Finished reports whether the model ended its answer on its own rather
+// than being cut off.
+func (r *Response) Finished() bool {
+	return r.StopReason == StopEndTurn || r.StopReason == StopSequence
+}
+
+// Result builds the Response for a finished stream, returning
+// ErrIncomplete with the partial response if the end of the message was
+// never seen.
+func Result(parser *prompt.StreamParser) (*Response, error) {
+	resp := &Response{
+		Text:       parser.Result(),
+		StopReason: StopReason(parser.StopReason()),
+		Usage:      parser.Usage(),
+		ToolCalls:  parser.ToolCalls(),
+		Reasoning:  parser.Reasoning(),
+		Thinking:   parser.Thinking(),
+	}
+	if !parser.Done() {
+		return resp, ErrIncomplete
+	}
+	return resp, nil
+}
+
+// Provider is implemented by every model backend.
+type Provider interface {
+	Name() string
+	Model() ModelInfo
+	Capabilities() Capabilities
+
+	// Complete sends the conversation and returns the whole answer.
+	// Cancelling ctx aborts the request.
+	Complete(ctx context.Context, conv *prompt.Conversation) (*Response, error)
+
+	// Stream is Complete with every event of the streamed answer passed
+	// to h as it arrives.
+	Stream(ctx context.Context, conv *prompt.Conversation, h prompt.Handler) (*Response, error)
+}
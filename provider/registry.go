@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Options configures a Provider created through New.
+type Options struct {
+	APIKey    string
+	Model     string
+	MaxTokens int
+
+	// BaseURL, AuthHeader and Headers override how HTTP providers reach
+	// their server; providers that don't need them ignore them.
+	BaseURL    string
+	AuthHeader string
+	Headers    map[string]string
+
+	// Retry overrides DefaultRetryPolicy when MaxAttempts is set.
+	Retry RetryPolicy
+
+	// HTTPClient replaces the provider's default client, for example to
+	// record traffic.
+	HTTPClient *http.Client
+}
+
+// Factory builds a Provider from validated options.
+type Factory func(opts Options) Provider
+
+type registration struct {
+	factory Factory
+	models  []ModelInfo
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]registration{}
+)
+
+// Register makes a provider available by name together with the models
+// it knows about; the first model is the default. It is meant to be
+// called from the init function of the package implementing the provider.
+func Register(name string, f Factory, models ...ModelInfo) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if f == nil {
+		panic("provider: Register factory is nil")
+	}
+	if len(models) == 0 {
+		panic("provider: Register called without models for " + name)
+	}
+	if _, dup := providers[name]; dup {
+		panic("provider: Register called twice for " + name)
+	}
+	providers[name] = registration{factory: f, models: models}
+}
+
+// AddModels makes more models selectable for a registered provider, for
+// backends such as local servers whose models are chosen by the user. A
+// model already registered under the same name is replaced.
+func AddModels(name string, models ...ModelInfo) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	r, ok := providers[name]
+	if !ok {
+		return fmt.Errorf("unknown provider %q", name)
+	}
+	// Copy so that the slice passed to Register is never written to.
+	r.models = append([]ModelInfo(nil), r.models...)
+	for _, m := range models {
+		if i := slices.IndexFunc(r.models, func(o ModelInfo) bool { return o.Name == m.Name }); i >= 0 {
+			r.models[i] = m
+		} else {
+			r.models = append(r.models, m)
+		}
+	}
+	providers[name] = r
+	return nil
+}
+
+// New returns the provider registered under name. An empty Model selects
+// the provider's default model and an empty MaxTokens the model's output
+// limit.
+func New(name string, opts Options) (Provider, error) {
+	mu.RLock()
+	r, ok := providers[name]
+	mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q (available: %v)", name, Names())
+	}
+
+	if opts.Model == "" {
+		opts.Model = r.models[0].Name
+	}
+	info, ok := FindModel(r.models, opts.Model)
+	if !ok {
+		return nil, fmt.Errorf("unknown model %q for provider %q (available: %v)", opts.Model, name, modelNames(r.models))
+	}
+
+	if opts.MaxTokens == 0 {
+		opts.MaxTokens = info.MaxOutputTokens
+	}
+	if opts.MaxTokens < 0 || opts.MaxTokens > info.MaxOutputTokens {
+		return nil, fmt.Errorf("max tokens %d out of range for %s (1-%d)", opts.MaxTokens, info.Name, info.MaxOutputTokens)
+	}
+
+	return r.factory(opts), nil
+}
+
+// Names returns the sorted list of registered provider names.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Models returns the models registered for a provider.
+func Models(name string) []ModelInfo {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return providers[name].models
+}
+
+// FindModel looks up a model by name.
+func FindModel(models []ModelInfo, name string) (ModelInfo, bool) {
+	for _, m := range models {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return ModelInfo{}, false
+}
+
+func modelNames(models []ModelInfo) []string {
+	names := make([]string, len(models))
+	for i, m := range models {
+		names[i] = m.Name
+	}
+	return names
+}
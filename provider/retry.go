@@ -0,0 +1,257 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how Do retries rate limited, overloaded and failed
+// requests.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	// OnRetry, when set, is called before waiting for the next attempt.
+	OnRetry func(err error, wait time.Duration)
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// APIError is a non-2xx response that isn't covered by a more specific
+// type.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("API error (%s): %s", e.Type, e.Message)
+	}
+	if e.Type != "" {
+		return fmt.Sprintf("API error %d (%s): %s", e.StatusCode, e.Type, e.Message)
+	}
+	return fmt.Sprintf("API error %d: %s", e.StatusCode, e.Message)
+}
+
+// RateLimitError is returned for 429 responses.
+type RateLimitError struct {
+	APIError
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "rate limited: " + e.APIError.Error() + retryAfterText(e.RetryAfter)
+}
+
+// OverloadedError is returned when the service reports it is overloaded,
+// such as Anthropic's 529 overloaded_error.
+type OverloadedError struct {
+	APIError
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return "service overloaded: " + e.APIError.Error() + retryAfterText(e.RetryAfter)
+}
+
+func retryAfterText(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (retry after %s)", d)
+}
+
+// AuthError is returned for 401 and 403 responses, which are never
+// retried.
+type AuthError struct {
+	APIError
+}
+
+func (e *AuthError) Error() string {
+	return "authentication failed, check the API key: " + e.APIError.Error()
+}
+
+// sleep waits for d or until ctx is done. It is replaced in tests.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Do sends the request built by newRequest and returns the response once
+// it has a 2xx status. Rate limits, overloads and 5xx responses are
+// retried with jittered exponential backoff, honoring retry-after headers.
+// newRequest is called for every attempt so the body can be re-sent, and
+// should attach ctx to the request so cancelling it aborts the stream.
+func Do(ctx context.Context, client *http.Client, policy RetryPolicy, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+
+	for attempt := 1; ; attempt++ {
+		request, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("error making request: %w", err)
+		}
+		if response.StatusCode >= 200 && response.StatusCode < 300 {
+			return response, nil
+		}
+
+		err = ResponseError(response)
+		response.Body.Close()
+
+		// A server asking for a longer wait than MaxDelay is not worth
+		// blocking on; its error says how long to wait instead.
+		wait, retryable := retryDelay(err)
+		if !retryable || attempt >= policy.MaxAttempts || wait > policy.MaxDelay {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = backoff(policy, attempt)
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(err, wait)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// EventError turns an error reported inside a stream into the same typed
+// errors used for HTTP responses.
+func EventError(errType, message string) error {
+	base := APIError{Type: errType, Message: message}
+	switch errType {
+	case "overloaded_error":
+		return &OverloadedError{APIError: base}
+	case "rate_limit_error":
+		return &RateLimitError{APIError: base}
+	case "authentication_error", "permission_error":
+		return &AuthError{APIError: base}
+	}
+	return &base
+}
+
+// ResponseError turns a non-2xx response into a typed error. It reads but
+// does not close the body.
+func ResponseError(response *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	base := APIError{StatusCode: response.StatusCode}
+	base.Type, base.Message = parseErrorBody(body)
+	if base.Message == "" {
+		base.Message = http.StatusText(response.StatusCode)
+	}
+	retryAfter := parseRetryAfter(response.Header)
+
+	switch {
+	case response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden:
+		return &AuthError{APIError: base}
+	case response.StatusCode == http.StatusTooManyRequests:
+		return &RateLimitError{APIError: base, RetryAfter: retryAfter}
+	case response.StatusCode == 529 || base.Type == "overloaded_error":
+		return &OverloadedError{APIError: base, RetryAfter: retryAfter}
+	}
+	return &base
+}
+
+// parseErrorBody understands {"error": {"type", "message"}} as sent by
+// Anthropic and OpenAI style APIs, and {"error": "message"} as sent by
+// Ollama.
+func parseErrorBody(body []byte) (string, string) {
+	var structured struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &structured) == nil && structured.Error.Message != "" {
+		return structured.Error.Type, structured.Error.Message
+	}
+
+	var plain struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &plain) == nil && plain.Error != "" {
+		return "", plain.Error
+	}
+
+	if len(body) > 200 {
+		body = body[:200]
+	}
+	return "", string(body)
+}
+
+func parseRetryAfter(h http.Header) time.Duration {
+	if ms := h.Get("retry-after-ms"); ms != "" {
+		if n, err := strconv.ParseFloat(ms, 64); err == nil && n > 0 {
+			return time.Duration(n * float64(time.Millisecond))
+		}
+	}
+	v := h.Get("retry-after")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// retryDelay reports whether err is worth retrying and the delay the
+// server asked for, if any.
+func retryDelay(err error) (time.Duration, bool) {
+	switch e := err.(type) {
+	case *RateLimitError:
+		return e.RetryAfter, true
+	case *OverloadedError:
+		return e.RetryAfter, true
+	case *APIError:
+		return 0, e.StatusCode >= 500
+	}
+	return 0, false
+}
+
+func backoff(policy RetryPolicy, attempt int) time.Duration {
+	d := policy.BaseDelay << (attempt - 1)
+	if d <= 0 || d > policy.MaxDelay {
+		d = policy.MaxDelay
+	}
+	// Full jitter over the upper half keeps clients from retrying in
+	// lockstep while still growing the delay.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
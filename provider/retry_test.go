@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []func(w http.ResponseWriter)
+		wantCalls int
+		wantErr   any
+		wantWaits []time.Duration
+	}{
+		{
+			name: "Rate limit honors retry-after",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.Header().Set("retry-after", "7")
+					w.WriteHeader(http.StatusTooManyRequests)
+					fmt.Fprint(w, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`)
+				},
+				func(w http.ResponseWriter) { fmt.Fprint(w, "ok") },
+			},
+			wantCalls: 2,
+			wantWaits: []time.Duration{7 * time.Second},
+		},
+		{
+			name: "Retry-after beyond max delay gives up",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.Header().Set("retry-after", "3600")
+					w.WriteHeader(http.StatusTooManyRequests)
+					fmt.Fprint(w, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`)
+				},
+			},
+			wantCalls: 1,
+			wantErr:   new(*RateLimitError),
+		},
+		{
+			name: "Overloaded until attempts run out",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.WriteHeader(529)
+					fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+				},
+			},
+			wantCalls: 3,
+			wantErr:   new(*OverloadedError),
+		},
+		{
+			name: "Auth errors are not retried",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.WriteHeader(http.StatusUnauthorized)
+					fmt.Fprint(w, `{"error":{"message":"Invalid API Key","type":"invalid_request_error"}}`)
+				},
+			},
+			wantCalls: 1,
+			wantErr:   new(*AuthError),
+		},
+		{
+			name: "Server errors are retried",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) },
+				func(w http.ResponseWriter) { fmt.Fprint(w, "ok") },
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "Bad requests are not retried",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(w, `{"error":"model not found"}`)
+				},
+			},
+			wantCalls: 1,
+			wantErr:   new(*APIError),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var waits []time.Duration
+			saved := sleep
+			sleep = func(ctx context.Context, d time.Duration) error {
+				waits = append(waits, d)
+				return nil
+			}
+			defer func() { sleep = saved }()
+
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := calls
+				if i >= len(tt.responses) {
+					i = len(tt.responses) - 1
+				}
+				calls++
+				tt.responses[i](w)
+			}))
+			defer server.Close()
+
+			policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Second}
+			resp, err := Do(context.Background(), server.Client(), policy, func() (*http.Request, error) {
+				return http.NewRequest("POST", server.URL, nil)
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr != nil {
+				if err == nil || !errors.As(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %T", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if tt.wantWaits != nil && fmt.Sprint(waits) != fmt.Sprint(tt.wantWaits) {
+				t.Errorf("got waits %v, want %v", waits, tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		d := backoff(policy, attempt+1)
+		if d < max/2 || d > max {
+			t.Errorf("attempt %d: backoff %s outside [%s, %s]", attempt+1, d, max/2, max)
+		}
+	}
+}
+
+func TestDoCancelledDuringBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(529)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Hour,
+		MaxDelay:    time.Hour,
+		OnRetry:     func(error, time.Duration) { cancel() },
+	}
+	_, err := Do(ctx, server.Client(), policy, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "POST", server.URL, nil)
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
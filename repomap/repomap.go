@@ -0,0 +1,372 @@
+// Package repomap builds a compact outline of a Go repository: the
+// packages, types, function signatures and method sets of every file,
+// ranked so that the most used declarations come first.
+//
+// Ranking follows the reference graph. Every file that mentions a name
+// declared in another file links to it; a PageRank over those links rates
+// the files, and each file's rating is shared among the declarations it
+// uses. Names are resolved without type checking, since the code may not
+// build: a name qualified by an import refers to that package, any other
+// name to its own package if declared there and otherwise to every
+// declaration of it, each getting an equal share.
+package repomap
+
+import (
+	"aaai/ignore"
+	"aaai/prompt"
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultBudget is the number of tokens an outline takes unless the
+// caller has a better idea.
+const DefaultBudget = 1024
+
+// Symbol is one top-level declaration.
+type Symbol struct {
+	File string
+	Name string
+	Line int
+
+	// Decl is the declaration as shown in the outline, without bodies.
+	Decl string
+
+	// Rank is the declaration's share of the reference graph.
+	Rank float64
+}
+
+// Map holds the declarations of a repository, highest ranked first.
+type Map struct {
+	Symbols []Symbol
+
+	// packages names the package of every file.
+	packages map[string]string
+}
+
+type file struct {
+	name    string
+	dir     string
+	pkg     string
+	symbols []Symbol
+	refs    map[ref]int
+}
+
+// ref is a use of a name, qualified by the package name it was selected
+// from if any.
+type ref struct {
+	pkg  string
+	name string
+}
+
+// Build parses the Go files under dir that are not ignored, leaving out
+// tests and files that don't parse.
+func Build(dir string) (*Map, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	ignored := ignore.New(dir)
+	fset := token.NewFileSet()
+
+	var files []*file
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if rel != "." && ignored.Ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(rel, ".go") || strings.HasSuffix(rel, "_test.go") || ignored.Ignored(rel, false) {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil
+		}
+		files = append(files, outline(fset, filepath.ToSlash(rel), f))
+		return nil
+	})
+
+	m := &Map{packages: map[string]string{}}
+	for _, f := range files {
+		m.packages[f.name] = f.pkg
+	}
+	m.Symbols = rank(files)
+	return m, nil
+}
+
+// outline collects the declarations of f and the names it uses.
+func outline(fset *token.FileSet, name string, f *ast.File) *file {
+	out := &file{name: name, dir: path.Dir(name), pkg: f.Name.Name, refs: map[ref]int{}}
+	add := func(ident *ast.Ident, decl string) {
+		out.symbols = append(out.symbols, Symbol{
+			File: name,
+			Name: ident.Name,
+			Line: fset.Position(ident.Pos()).Line,
+			Decl: decl,
+		})
+	}
+
+	// Identifiers that declare something aren't uses of it.
+	declared := map[*ast.Ident]bool{}
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			declared[d.Name] = true
+			sig := *d
+			sig.Doc, sig.Body = nil, nil
+			add(d.Name, node(fset, &sig))
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					declared[s.Name] = true
+					add(s.Name, "type "+s.Name.Name+" "+typeOutline(fset, s.Type))
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						declared[n] = true
+						if n.IsExported() {
+							add(n, d.Tok.String()+" "+n.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	imports := map[string]bool{}
+	for _, imp := range f.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		name := path.Base(p)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		imports[name] = true
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok && imports[x.Name] {
+				out.refs[ref{x.Name, n.Sel.Name}]++
+				return false
+			}
+		case *ast.Ident:
+			if !declared[n] {
+				out.refs[ref{"", n.Name}]++
+			}
+		}
+		return true
+	})
+	delete(out.refs, ref{"", f.Name.Name})
+	return out
+}
+
+// typeOutline shortens a type to its shape: field names of structs,
+// method signatures of interfaces, and other types in full.
+func typeOutline(fset *token.FileSet, expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		var names []string
+		for _, field := range t.Fields.List {
+			for _, n := range field.Names {
+				names = append(names, n.Name)
+			}
+			if len(field.Names) == 0 {
+				names = append(names, node(fset, field.Type))
+			}
+		}
+		if len(names) == 0 {
+			return "struct{}"
+		}
+		return "struct { " + strings.Join(names, ", ") + " }"
+	case *ast.InterfaceType:
+		var methods []string
+		for _, field := range t.Methods.List {
+			if len(field.Names) == 0 {
+				methods = append(methods, node(fset, field.Type))
+				continue
+			}
+			sig := strings.TrimPrefix(node(fset, field.Type), "func")
+			methods = append(methods, field.Names[0].Name+sig)
+		}
+		if len(methods) == 0 {
+			return "interface{}"
+		}
+		return "interface { " + strings.Join(methods, "; ") + " }"
+	}
+	return node(fset, expr)
+}
+
+func node(fset *token.FileSet, n ast.Node) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, n)
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+// rank scores every declaration by the reference graph and returns them
+// highest first.
+func rank(files []*file) []Symbol {
+	defs := map[string][]int{} // declaring files by name
+	for i, f := range files {
+		for _, s := range f.symbols {
+			defs[s.Name] = append(defs[s.Name], i)
+		}
+	}
+
+	// Each file links to the files declaring the names it uses, weighted
+	// by how often it uses them, though with diminishing returns so that
+	// ubiquitous names don't drown out the rest.
+	type edge struct {
+		to     int
+		name   string
+		weight float64
+	}
+	edges := make([][]edge, len(files))
+	out := make([]float64, len(files))
+	for i, f := range files {
+		for r, n := range f.refs {
+			targets := resolve(files, defs[r.name], f, r)
+			for _, j := range targets {
+				w := math.Sqrt(float64(n)) / float64(len(targets))
+				if i == j {
+					w *= 0.1
+				}
+				edges[i] = append(edges[i], edge{j, r.name, w})
+				out[i] += w
+			}
+		}
+	}
+
+	const damping, iterations = 0.85, 30
+	n := float64(len(files))
+	ranks := make([]float64, len(files))
+	for i := range ranks {
+		ranks[i] = 1 / n
+	}
+	for range iterations {
+		next := make([]float64, len(files))
+		dangling := 0.0
+		for i, es := range edges {
+			if out[i] == 0 {
+				dangling += ranks[i]
+				continue
+			}
+			for _, e := range es {
+				next[e.to] += damping * ranks[i] * e.weight / out[i]
+			}
+		}
+		for i := range next {
+			next[i] += (1-damping)/n + damping*dangling/n
+		}
+		ranks = next
+	}
+
+	// A declaration gets the rank flowing along the edges that use it.
+	share := map[[2]string]float64{}
+	for i, es := range edges {
+		for _, e := range es {
+			share[[2]string{files[e.to].name, e.name}] += ranks[i] * e.weight / out[i]
+		}
+	}
+
+	var symbols []Symbol
+	for _, f := range files {
+		for _, s := range f.symbols {
+			s.Rank = share[[2]string{s.File, s.Name}]
+			symbols = append(symbols, s)
+		}
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		a, b := symbols[i], symbols[j]
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+		if ast.IsExported(a.Name) != ast.IsExported(b.Name) {
+			return ast.IsExported(a.Name)
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return symbols
+}
+
+// resolve returns the files among defs that a use r in f may refer to.
+func resolve(files []*file, defs []int, f *file, r ref) []int {
+	var local, qualified []int
+	for _, j := range defs {
+		switch {
+		case r.pkg != "" && files[j].pkg == r.pkg && files[j].dir != f.dir:
+			qualified = append(qualified, j)
+		case files[j].dir == f.dir:
+			local = append(local, j)
+		}
+	}
+	switch {
+	case r.pkg != "":
+		return qualified
+	case len(local) > 0:
+		return local
+	}
+	return defs
+}
+
+// Render writes the highest ranked declarations that fit in budget tokens,
+// grouped by file in source order. Files for which skip returns true are
+// left out, as the prompt already holds them in full.
+func (m *Map) Render(budget int, skip func(file string) bool) string {
+	chosen := map[string][]Symbol{}
+	used := 0
+	for _, s := range m.Symbols {
+		if skip != nil && skip(s.File) {
+			continue
+		}
+		cost := prompt.EstimateTokens(s.Decl) + 1
+		if len(chosen[s.File]) == 0 {
+			cost += prompt.EstimateTokens(s.File+m.packages[s.File]) + 2
+		}
+		if used+cost > budget {
+			continue
+		}
+		used += cost
+		chosen[s.File] = append(chosen[s.File], s)
+	}
+
+	names := make([]string, 0, len(chosen))
+	for name := range chosen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf strings.Builder
+	for _, name := range names {
+		symbols := chosen[name]
+		sort.Slice(symbols, func(i, j int) bool { return symbols[i].Line < symbols[j].Line })
+		buf.WriteString(name + " (package " + m.packages[name] + "):\n")
+		for _, s := range symbols {
+			buf.WriteString("  " + s.Decl + "\n")
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,126 @@
+package repomap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRepo(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	return dir
+}
+
+func TestBuild(t *testing.T) {
+	dir := writeRepo(t, map[string]string{
+		"shape/shape.go": `package shape
+
+// Shape is drawn.
+type Shape interface {
+	Area() float64
+}
+
+type Square struct {
+	Side, scale float64
+}
+
+func (s *Square) Area() float64 { return s.Side * s.Side }
+
+func unused(n int) int { return n }
+
+const Max = 10
+`,
+		"draw/draw.go": `package draw
+
+import "example/shape"
+
+func Draw(s shape.Shape) float64 {
+	var sq shape.Square
+	_ = sq
+	return s.Area() + float64(shape.Max)
+}
+`,
+		"main.go": `package main
+
+import (
+	"example/draw"
+	sh "example/shape"
+)
+
+func main() {
+	draw.Draw(&sh.Square{Side: 2})
+	var s sh.Shape
+	_ = s
+}
+`,
+		"shape/shape_test.go": "package shape\n\nfunc TestIgnored() {}\n",
+		"broken.go":           "package main\n\nfunc (\n",
+		"vendor/v/v.go":       "package v\n\nfunc Vendored() {}\n",
+	})
+
+	m, err := Build(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decls := map[string]Symbol{}
+	for _, s := range m.Symbols {
+		decls[s.Name] = s
+	}
+	for name, decl := range map[string]string{
+		"Shape":  "type Shape interface { Area() float64 }",
+		"Square": "type Square struct { Side, scale }",
+		"Area":   "func (s *Square) Area() float64",
+		"unused": "func unused(n int) int",
+		"Max":    "const Max",
+		"Draw":   "func Draw(s shape.Shape) float64",
+	} {
+		if got := decls[name].Decl; got != decl {
+			t.Errorf("%s: got %q, want %q", name, got, decl)
+		}
+	}
+	for _, name := range []string{"TestIgnored", "Vendored"} {
+		if _, ok := decls[name]; ok {
+			t.Errorf("%s should not be in the map", name)
+		}
+	}
+
+	rank := map[string]int{}
+	for i, s := range m.Symbols {
+		rank[s.Name] = i
+	}
+	if rank["Shape"] > rank["unused"] || rank["Square"] > rank["unused"] || rank["Draw"] > rank["unused"] {
+		t.Errorf("used declarations should rank above unused ones: %v", rank)
+	}
+}
+
+func TestRender(t *testing.T) {
+	dir := writeRepo(t, map[string]string{
+		"a/a.go": "package a\n\nfunc A() {}\n\nfunc B() {}\n",
+		"b/b.go": "package b\n\nimport \"x/a\"\n\nfunc C() { a.A(); a.B() }\n",
+	})
+	m, err := Build(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "a/a.go (package a):\n  func A()\n  func B()\nb/b.go (package b):\n  func C()\n"
+	if got := m.Render(1000, nil); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	got := m.Render(1000, func(file string) bool { return file == "a/a.go" })
+	if got != "b/b.go (package b):\n  func C()\n" {
+		t.Errorf("skipped file rendered:\n%s", got)
+	}
+
+	if got := m.Render(8, nil); strings.Count(got, "func") != 1 {
+		t.Errorf("budget not respected:\n%s", got)
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"aaai/agent"
+	"aaai/checkpoint"
+	"aaai/diff"
+	"aaai/prompt"
+	"aaai/provider"
+	"aaai/repomap"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// session is the state of one REPL run against a directory.
+type session struct {
+	dir    string
+	client provider.Provider
+	conv   *prompt.Conversation
+
+	// agent, when set, lets the model explore the repository with tools
+	// instead of receiving the files in the prompt.
+	agent *agent.Agent
+
+	// sent is the file context of the previous request, kept to order
+	// the next one so unchanged files form a cacheable prefix.
+	sent []prompt.FileContent
+
+	// read lists the conventions files sent read-only with every
+	// request, CONVENTIONS.md if empty.
+	read []string
+
+	// chat holds the files added with /add and /read-only, mapped to
+	// whether they are read-only. When it is empty files are chosen for
+	// each request.
+	chat map[string]bool
+
+	// confirm asks the user a yes or no question; nil answers no.
+	confirm func(question string) bool
+
+	// notes tell the model, with the next request, what became of its
+	// previous answer.
+	notes []string
+
+	// attachments are sent with the next request.
+	attachments []prompt.Attachment
+
+	// checkpoints record applied edits for /undo.
+	checkpoints *checkpoint.Store
+
+	usage prompt.Usage
+	cost  float64
+}
+
+func newSession(dir string, client provider.Provider) *session {
+	return &session{
+		dir:    dir,
+		client: client,
+		conv:   prompt.NewConversation(),
+		chat:   map[string]bool{},
+
+		checkpoints: checkpoint.New(dir),
+	}
+}
+
+// submit sends request together with the current files and applies the
+// diffs found in the answer. Cancelling ctx discards the response.
+func (s *session) submit(ctx context.Context, request string) error {
+	asked := request
+	if len(s.notes) > 0 {
+		request = strings.Join(append(s.notes, request), "\n\n")
+	}
+
+	// Conventions come first and rarely change, so they always count as
+	// part of the stable prefix.
+	pm := prompt.NewPromptManager()
+	if err := pm.LoadConventions(s.dir, s.read); err != nil {
+		fmt.Println(err)
+	}
+	conventions := pm.Files
+	conventionTokens := 0
+	for _, f := range conventions {
+		conventionTokens += prompt.EstimateTokens(f.Content)
+	}
+
+	var fcs []prompt.FileContent
+	stable := 0
+	if s.agent == nil {
+		budget := s.fileBudget(request)
+		if budget > 0 {
+			budget = max(budget-repomap.DefaultBudget-conventionTokens, 0)
+		}
+		var files []prompt.FileContent
+		if len(s.chat) > 0 {
+			files = s.chatFiles(budget)
+		} else {
+			var dropped []string
+			files, dropped = prompt.AssembleFiles(s.dir, prompt.Selection{
+				Budget:  budget,
+				Request: request,
+			})
+			if len(dropped) > 0 {
+				fmt.Printf("%d files left out to fit the context window: %s\n", len(dropped), list(dropped, 10))
+			}
+		}
+		fcs, stable = prompt.StableOrder(s.sent, withoutFiles(files, conventions))
+		s.sent = fcs
+	}
+	pm.Files = append(pm.Files, fcs...)
+	pm.RepoMap = s.repoMap(pm.Files)
+	p := pm.BuildPrompt(request)
+	p.Stable = len(conventions) + stable
+	if s.agent != nil {
+		p.System += "\n\n" + agent.Instructions
+	}
+	s.conv.System = p.System
+	s.conv.Context = p.Context
+	s.conv.StableContext = p.Stable
+
+	var resp *provider.Response
+	var err error
+	term := prompt.NewTerminal(os.Stdout)
+	if s.agent != nil {
+		s.agent.Toolbox.Read = map[string]bool{}
+		resp, err = s.agent.Run(ctx, s.conv.With(p.Request, s.attachments...), term)
+	} else {
+		resp, err = s.client.Stream(ctx, s.conv.With(p.Request, s.attachments...), term)
+	}
+	if resp != nil {
+		footer := s.account(resp.Usage)
+		defer fmt.Println(footer)
+	}
+	if ctx.Err() != nil {
+		return errors.New("\ngeneration cancelled, response discarded")
+	}
+	if err != nil {
+		if resp != nil && resp.Text != "" {
+			return fmt.Errorf("%w; not applying diffs from the partial response", err)
+		}
+		return err
+	}
+	// History keeps just the request; the current file contents are
+	// sent fresh with every turn, and attachments only with this one.
+	s.conv.AddUser(request)
+	s.conv.AddAssistant(resp.Text)
+	s.attachments = nil
+	s.notes = nil
+
+	if !resp.Finished() {
+		return fmt.Errorf("response stopped early (%s), not applying diffs", stopReason(resp))
+	}
+
+	fmt.Println("")
+	fmt.Println("")
+	fmt.Println("")
+	fmt.Println("")
+	fmt.Println(resp.Text)
+	m := prompt.ParseDiffs(resp.Text)
+	fmt.Println("===")
+	fmt.Println(m)
+	fmt.Println("===")
+
+	shown := map[string]bool{}
+	for _, f := range pm.Files {
+		shown[filepath.ToSlash(f.Filename)] = !f.ReadOnly
+	}
+	if s.agent != nil {
+		// Reading a file with a tool makes it editable, unless it is
+		// already known to be read-only.
+		for path, readOnly := range s.chat {
+			if _, ok := shown[path]; !ok {
+				shown[path] = !readOnly
+			}
+		}
+		for path := range s.agent.Toolbox.Read {
+			if _, ok := shown[path]; !ok {
+				shown[path] = true
+			}
+		}
+	}
+	return s.apply(s.permitted(m, shown), commitMessage(asked))
+}
+
+// permitted returns the diffs to files the model may edit: those in shown
+// mapped to true. Edits to read-only files or files the model never saw
+// are dropped unless the user confirms them, and the model is told about
+// the ones dropped with the next request.
+func (s *session) permitted(diffs map[string]string, shown map[string]bool) map[string]string {
+	names := make([]string, 0, len(diffs))
+	for name := range diffs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	allowed := map[string]string{}
+	var refused []string
+	for _, name := range names {
+		editable, ok := shown[filepath.ToSlash(filepath.Clean(name))]
+		if editable {
+			allowed[name] = diffs[name]
+			continue
+		}
+		problem, note := "is read-only", "is read-only"
+		if !ok {
+			problem, note = "was never shown to the model", "was not shown to you"
+		}
+		if s.confirm != nil && s.confirm(fmt.Sprintf("%s %s; apply the edit anyway?", name, problem)) {
+			allowed[name] = diffs[name]
+			continue
+		}
+		fmt.Printf("not applying the edit to %s, which %s\n", name, problem)
+		refused = append(refused, name+" "+note)
+	}
+	if len(refused) > 0 {
+		s.notes = append(s.notes, "Your edits were not applied to these files: "+strings.Join(refused, "; ")+".")
+	}
+	return allowed
+}
+
+// withoutFiles returns files minus those named in drop.
+func withoutFiles(files, drop []prompt.FileContent) []prompt.FileContent {
+	var out []prompt.FileContent
+	for _, f := range files {
+		if !slices.ContainsFunc(drop, func(d prompt.FileContent) bool { return d.Filename == f.Filename }) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// chatFiles reads the files in the chat, warning when they exceed budget.
+func (s *session) chatFiles(budget int) []prompt.FileContent {
+	var files []prompt.FileContent
+	tokens := 0
+	for _, path := range s.chatPaths() {
+		content, err := os.ReadFile(filepath.Join(s.dir, path))
+		if err != nil {
+			fmt.Printf("skipping %s: %v\n", path, err)
+			continue
+		}
+		fc := prompt.FileContent{
+			Filename: filepath.FromSlash(path),
+			Content:  string(content),
+			ReadOnly: s.chat[path],
+		}
+		tokens += prompt.EstimateTokens(fc.Content)
+		files = append(files, fc)
+	}
+	if budget >= 0 && tokens > budget {
+		fmt.Printf("the files in the chat take about %d tokens, more than the %d left in the context window\n", tokens, budget)
+	}
+	return files
+}
+
+// fileBudget returns the tokens left for files in the model's context
+// window once the answer, system prompt, history and request are
+// accounted for, or -1 if the window is unknown.
+func (s *session) fileBudget(request string) int {
+	m := s.client.Model()
+	if m.ContextWindow == 0 {
+		return -1
+	}
+	used := m.MaxOutputTokens + prompt.EstimateTokens(prompt.MakePrompt(request, nil).System)
+	used += prompt.EstimateTokens(request)
+	for _, msg := range s.conv.Messages {
+		used += prompt.EstimateTokens(msg.Content)
+	}
+	// Keep a tenth of the window in reserve as the estimates are rough.
+	return max(m.ContextWindow*9/10-used, 0)
+}
+
+// repoMap outlines the Go files of the repository that are not in files.
+func (s *session) repoMap(files []prompt.FileContent) string {
+	m, err := repomap.Build(s.dir)
+	if err != nil {
+		return ""
+	}
+	sent := map[string]bool{}
+	for _, f := range files {
+		sent[filepath.ToSlash(f.Filename)] = true
+	}
+	return m.Render(repomap.DefaultBudget, func(file string) bool { return sent[file] })
+}
+
+// list joins up to n names, noting how many more there are.
+func list(names []string, n int) string {
+	if len(names) <= n {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:n], ", "), len(names)-n)
+}
+
+// attach adds the PDF or image at path to the next request.
+func (s *session) attach(path string) error {
+	if !s.client.Capabilities().Attachments {
+		return fmt.Errorf("provider %s does not support attachments", s.client.Name())
+	}
+	a, err := prompt.LoadAttachment(path)
+	if err != nil {
+		return err
+	}
+	total := a.EncodedSize()
+	for _, prev := range s.attachments {
+		total += prev.EncodedSize()
+	}
+	if total > prompt.MaxPDFSize {
+		return fmt.Errorf("%s: the attachments would be %d MB once encoded, over the %d MB a request can carry", path, total>>20, prompt.MaxPDFSize>>20)
+	}
+	s.attachments = append(s.attachments, a)
+	fmt.Printf("attached %s (%s, %d KB) to the next request\n", path, a.MediaType, (len(a.Data)+1023)/1024)
+	return nil
+}
+
+// apply patches every file in diffs, keeping the original and the diff
+// under tests/ for debugging. The edit is recorded as a checkpoint, and
+// committed with message in a git work tree; if any file fails to patch,
+// all of them are restored.
+func (s *session) apply(diffs map[string]string, message string) error {
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	// Create tests directory if it doesn't exist
+	testsDir := "tests"
+	if err := os.MkdirAll(testsDir, 0755); err != nil {
+		return fmt.Errorf("error creating tests directory: %w", err)
+	}
+
+	names := make([]string, 0, len(diffs))
+	for k := range diffs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	cp := s.checkpoints.Begin(names)
+
+	for _, k := range names {
+		v := diffs[k]
+		// Get original file content
+		origContent, origErr := os.ReadFile(filepath.Join(s.dir, k))
+
+		// Write original file to tests/file.orig
+		origPath := filepath.Join(testsDir, k+".orig")
+		if err := os.MkdirAll(filepath.Dir(origPath), 0755); err != nil {
+			fmt.Printf("Error creating directory for %s: %v\n", origPath, err)
+			continue
+		}
+		if origErr == nil {
+			os.WriteFile(origPath, origContent, 0644)
+		}
+		// Write diff to tests/file.diff
+		os.WriteFile(filepath.Join(testsDir, k+".diff"), []byte(v), 0644)
+		if err := diff.Patch(s.dir+"/"+k, v); err != nil {
+			if rerr := s.checkpoints.Restore(cp); rerr != nil {
+				return errors.Join(err, rerr)
+			}
+			return fmt.Errorf("%w; no files were changed", err)
+		}
+	}
+	if err := s.checkpoints.Commit(cp, message); err != nil {
+		fmt.Println(err)
+	} else if cp.Commit != "" {
+		fmt.Printf("committed %s, /undo to revert\n", cp.Commit[:7])
+	}
+	return nil
+}
+
+// commitMessage summarizes request in the subject line of an edit's
+// commit.
+func commitMessage(request string) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(request), "\n")
+	if r := []rune(subject); len(r) > 60 {
+		subject = strings.TrimSpace(string(r[:57])) + "..."
+	}
+	return "aaai: " + subject
+}
+
+func stopReason(resp *provider.Response) string {
+	if resp.StopReason == "" {
+		return "no stop reason"
+	}
+	return string(resp.StopReason)
+}
+
+// account adds a turn's usage to the session totals and returns the
+// footer line describing both.
+func (s *session) account(u prompt.Usage) string {
+	model := s.client.Model().Name
+	s.usage.Add(u)
+	cost, known := provider.Cost(model, u)
+	s.cost += cost
+
+	turn := fmt.Sprintf("tokens: %d in, %d out", u.InputTokens, u.OutputTokens)
+	if u.CacheReadTokens > 0 || u.CacheWriteTokens > 0 {
+		input := u.InputTokens + u.CacheReadTokens + u.CacheWriteTokens
+		turn += fmt.Sprintf(", cache %d hit, %d written (%d%% of input)",
+			u.CacheReadTokens, u.CacheWriteTokens, 100*u.CacheReadTokens/input)
+	}
+	total := fmt.Sprintf("session: %d in, %d out", s.usage.InputTokens, s.usage.OutputTokens)
+	if !known {
+		return turn + " | " + total + " (no price for " + model + ")"
+	}
+	return fmt.Sprintf("%s, $%.4f | %s, $%.4f", turn, cost, total, s.cost)
+}